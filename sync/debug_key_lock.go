@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// debugHolder is an acquisition tracked by a debug KeyLock along with the stack it was acquired from.
+type debugHolder[K comparable] struct {
+	Holder[K]
+	stack []byte
+	timer *time.Timer
+}
+
+type debugKeyLock[K comparable] struct {
+	inner     KeyLock[K]
+	threshold time.Duration
+
+	guard   sync.Mutex
+	holders map[K][]*debugHolder[K]
+}
+
+// NewDebugKeyLock returns a KeyLock which detects misuse of l. Releasing a key which is not locked
+// in the given mode panics with the key and the acquisition stacks of its current holders, instead
+// of failing deep inside l. A warning with the holder's stack is logged whenever a lock is held for
+// longer than threshold, which surfaces forgotten unlocks. A threshold of zero or less disables the
+// warnings. Capturing stacks is expensive, so this is meant for development and tests.
+func NewDebugKeyLock[K comparable](l KeyLock[K], threshold time.Duration) KeyLock[K] {
+	return &debugKeyLock[K]{
+		inner:     l,
+		threshold: threshold,
+		holders:   map[K][]*debugHolder[K]{},
+	}
+}
+
+func (l *debugKeyLock[K]) Lock(key K) {
+	l.inner.Lock(key)
+	l.acquired(key, true)
+}
+
+func (l *debugKeyLock[K]) Unlock(key K) {
+	l.released(key, true)
+	l.inner.Unlock(key)
+}
+
+func (l *debugKeyLock[K]) RLock(key K) {
+	l.inner.RLock(key)
+	l.acquired(key, false)
+}
+
+func (l *debugKeyLock[K]) RUnlock(key K) {
+	l.released(key, false)
+	l.inner.RUnlock(key)
+}
+
+func (l *debugKeyLock[K]) LockContext(ctx context.Context, key K) error {
+	if err := l.inner.LockContext(ctx, key); err != nil {
+		return err
+	}
+	l.acquired(key, true)
+	return nil
+}
+
+func (l *debugKeyLock[K]) RLockContext(ctx context.Context, key K) error {
+	if err := l.inner.RLockContext(ctx, key); err != nil {
+		return err
+	}
+	l.acquired(key, false)
+	return nil
+}
+
+func (l *debugKeyLock[K]) TryLock(key K) bool {
+	if !l.inner.TryLock(key) {
+		return false
+	}
+	l.acquired(key, true)
+	return true
+}
+
+func (l *debugKeyLock[K]) TryRLock(key K) bool {
+	if !l.inner.TryRLock(key) {
+		return false
+	}
+	l.acquired(key, false)
+	return true
+}
+
+func (l *debugKeyLock[K]) acquired(key K, write bool) {
+	buf := make([]byte, 1<<16)
+	h := &debugHolder[K]{
+		Holder: Holder[K]{Key: key, Write: write, Goroutine: goroutineID(), Caller: callerOf(2), Since: time.Now()},
+		stack:  buf[:runtime.Stack(buf, false)],
+	}
+	if l.threshold > 0 {
+		h.timer = time.AfterFunc(l.threshold, func() {
+			log.Warnf("key lock %v held for more than %s by goroutine %d, acquired at:\n%s", h.Key, l.threshold, h.Goroutine, h.stack)
+		})
+	}
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	l.holders[key] = append(l.holders[key], h)
+}
+
+func (l *debugKeyLock[K]) released(key K, write bool) {
+	gid := goroutineID()
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	holders := l.holders[key]
+	i := findHolder(holders, func(h *debugHolder[K]) *Holder[K] { return &h.Holder }, write, gid)
+	if i < 0 {
+		panic(unlockOfUnlockedKey(key, write, holders))
+	}
+	if holders[i].timer != nil {
+		holders[i].timer.Stop()
+	}
+	holders = append(holders[:i], holders[i+1:]...)
+	if len(holders) == 0 {
+		delete(l.holders, key)
+	} else {
+		l.holders[key] = holders
+	}
+}
+
+func unlockOfUnlockedKey[K comparable](key K, write bool, holders []*debugHolder[K]) string {
+	var b strings.Builder
+	if write {
+		fmt.Fprintf(&b, "sync: Unlock of key %v which is not write-locked", key)
+	} else {
+		fmt.Fprintf(&b, "sync: RUnlock of key %v which is not read-locked", key)
+	}
+	for _, h := range holders {
+		mode := "read"
+		if h.Write {
+			mode = "write"
+		}
+		fmt.Fprintf(&b, "\n\n%s-locked by goroutine %d at:\n%s", mode, h.Goroutine, h.stack)
+	}
+	return b.String()
+}
@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDebugKeyLockUnlockOfUnlockedKey(t *testing.T) {
+	l := NewDebugKeyLock(NewKeyLock(), 0)
+
+	assert.PanicsWithValue(t, "sync: Unlock of key my-key which is not write-locked", func() {
+		l.Unlock("my-key")
+	})
+
+	l.RLock("my-key")
+	defer l.RUnlock("my-key")
+	defer func() {
+		r := recover()
+		require.NotNil(t, r)
+		msg := r.(string)
+		assert.Contains(t, msg, "sync: Unlock of key my-key which is not write-locked")
+		assert.Contains(t, msg, "read-locked by goroutine")
+		assert.Contains(t, msg, "TestDebugKeyLockUnlockOfUnlockedKey")
+	}()
+	l.Unlock("my-key")
+}
+
+func TestDebugKeyLockRUnlockOfUnlockedKey(t *testing.T) {
+	l := NewDebugKeyLock(NewKeyLock(), 0)
+
+	require.NoError(t, l.LockContext(context.Background(), "my-key"))
+	assert.Panics(t, func() {
+		l.RUnlock("my-key")
+	})
+	l.Unlock("my-key")
+
+	assert.Empty(t, l.(*debugKeyLock[string]).holders)
+}
+
+func TestDebugKeyLockHeldTooLong(t *testing.T) {
+	l := NewDebugKeyLock(NewKeyLock(), 10*time.Millisecond)
+
+	var buf syncBuffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+
+	l.Lock("quick-key")
+	l.Unlock("quick-key")
+	l.Lock("my-key")
+	require.Eventually(t, func() bool {
+		return bytes.Contains(buf.Bytes(), []byte("key lock my-key held for more than 10ms"))
+	}, time.Second, time.Millisecond)
+	l.Unlock("my-key")
+
+	assert.NotContains(t, buf.String(), "quick-key")
+	assert.Contains(t, buf.String(), "TestDebugKeyLockHeldTooLong")
+}
+
+// syncBuffer is a bytes.Buffer which can be written to and read from concurrently.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func (b *syncBuffer) String() string {
+	return string(b.Bytes())
+}
@@ -0,0 +1,29 @@
+package sync
+
+// FairnessPolicy decides in which order the goroutines waiting for a key acquire it.
+type FairnessPolicy int
+
+const (
+	// FairnessFIFO grants a key in the order it was requested in, with consecutive readers acquiring
+	// it together. A reader arriving while a writer waits queues behind the writer, so neither side
+	// can starve the other.
+	FairnessFIFO FairnessPolicy = iota
+	// FairnessWriterPreferring grants a key to waiting writers before any waiting reader, and lets
+	// no new reader in while a writer waits. A steady stream of writers can starve readers.
+	FairnessWriterPreferring
+	// FairnessReaderPreferring lets readers in whenever no writer holds a key, even if writers are
+	// waiting. A steady stream of readers can starve writers.
+	FairnessReaderPreferring
+)
+
+func (p FairnessPolicy) String() string {
+	switch p {
+	case FairnessFIFO:
+		return "FIFO"
+	case FairnessWriterPreferring:
+		return "WriterPreferring"
+	case FairnessReaderPreferring:
+		return "ReaderPreferring"
+	}
+	return "Unknown"
+}
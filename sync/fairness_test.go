@@ -0,0 +1,126 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// acquisitionOrder write-locks a key, queues the given waiters one after the other ("r" for readers,
+// "w" for writers) and returns the order in which they acquired the key once it is unlocked.
+func acquisitionOrder(t *testing.T, policy FairnessPolicy, waiting ...string) []string {
+	t.Helper()
+	l := NewKeyLockWithPolicy[string](policy)
+	l.Lock("my-key")
+
+	var mu sync.Mutex
+	var order []string
+	wg := sync.WaitGroup{}
+	for i, name := range waiting {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			write := name[0] == 'w'
+			if write {
+				l.Lock("my-key")
+			} else {
+				l.RLock("my-key")
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			if write {
+				l.Unlock("my-key")
+			} else {
+				l.RUnlock("my-key")
+			}
+		}()
+		require.Eventually(t, func() bool {
+			return waiters(l, "my-key") == i+1
+		}, time.Second, time.Millisecond)
+	}
+
+	l.Unlock("my-key")
+	wg.Wait()
+	assert.Empty(t, l.(*keyLock[string]).locks)
+	return order
+}
+
+func TestFairnessFIFO(t *testing.T) {
+	order := acquisitionOrder(t, FairnessFIFO, "r1", "w1", "r2", "w2")
+	assert.Equal(t, []string{"r1", "w1", "r2", "w2"}, order)
+}
+
+func TestFairnessWriterPreferring(t *testing.T) {
+	order := acquisitionOrder(t, FairnessWriterPreferring, "r1", "w1", "r2", "w2")
+	assert.Equal(t, []string{"w1", "w2"}, order[:2])
+	assert.ElementsMatch(t, []string{"r1", "r2"}, order[2:])
+}
+
+func TestFairnessReaderPreferring(t *testing.T) {
+	order := acquisitionOrder(t, FairnessReaderPreferring, "w1", "r1", "w2", "r2")
+	assert.ElementsMatch(t, []string{"r1", "r2"}, order[:2])
+	assert.Equal(t, []string{"w1", "w2"}, order[2:])
+}
+
+func TestFairnessNewReaders(t *testing.T) {
+	for _, test := range []struct {
+		policy  FairnessPolicy
+		allowed bool
+	}{
+		{FairnessFIFO, false},
+		{FairnessWriterPreferring, false},
+		{FairnessReaderPreferring, true},
+	} {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			l := NewKeyLockWithPolicy[string](test.policy)
+			l.RLock("my-key")
+
+			done := make(chan struct{})
+			go func() {
+				l.Lock("my-key")
+				close(done)
+			}()
+			require.Eventually(t, func() bool {
+				return waiters(l, "my-key") == 1
+			}, time.Second, time.Millisecond)
+
+			// whether a new reader may overtake the waiting writer
+			assert.Equal(t, test.allowed, l.TryRLock("my-key"))
+			if test.allowed {
+				l.RUnlock("my-key")
+			}
+
+			l.RUnlock("my-key")
+			<-done
+			l.Unlock("my-key")
+		})
+	}
+}
+
+func TestFairnessWriterPreferringCancelledWriter(t *testing.T) {
+	l := NewKeyLockWithPolicy[string](FairnessWriterPreferring)
+	l.RLock("my-key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	writerDone := make(chan error)
+	go func() {
+		writerDone <- l.LockContext(ctx, "my-key")
+	}()
+	require.Eventually(t, func() bool {
+		return waiters(l, "my-key") == 1
+	}, time.Second, time.Millisecond)
+	assert.False(t, l.TryRLock("my-key"))
+
+	cancel()
+	require.Error(t, <-writerDone)
+	assert.True(t, l.TryRLock("my-key"))
+
+	l.RUnlock("my-key")
+	l.RUnlock("my-key")
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
@@ -0,0 +1,237 @@
+// Package filelock provides a KeyLock which serializes work across processes on the same node by
+// means of advisory locks on per-key files in a shared directory.
+package filelock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	argosync "github.com/argoproj/pkg/v2/sync"
+)
+
+const (
+	lockFileSuffix = ".lock"
+	minPollPeriod  = 5 * time.Millisecond
+	maxPollPeriod  = 200 * time.Millisecond
+)
+
+// errWouldBlock is returned by lockFile if the file is locked by someone else.
+var errWouldBlock = errors.New("file is locked")
+
+type keyLock struct {
+	dir string
+
+	guard sync.Mutex
+	held  map[string][]*heldFile
+}
+
+// heldFile is a lock file locked by this process.
+type heldFile struct {
+	file  *os.File
+	write bool
+}
+
+// NewKeyLock returns a KeyLock which locks a file per key in dir, creating dir if needed. Locks are
+// shared by all processes using the same directory and are released by the operating system should
+// the holding process die. Lock files are removed again when they are unlocked; files left behind by
+// processes which died can be removed with Cleanup.
+func NewKeyLock(dir string) (argosync.KeyLock[string], error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+	return &keyLock{
+		dir:  dir,
+		held: map[string][]*heldFile{},
+	}, nil
+}
+
+// FileName returns the name of the file backing the given key.
+func FileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + lockFileSuffix
+}
+
+func (l *keyLock) Lock(key string) {
+	if _, err := l.lock(context.Background(), key, true, true); err != nil {
+		panic(fmt.Sprintf("filelock: failed to lock key %s: %v", key, err))
+	}
+}
+
+func (l *keyLock) Unlock(key string) {
+	l.unlock(key, true)
+}
+
+func (l *keyLock) RLock(key string) {
+	if _, err := l.lock(context.Background(), key, false, true); err != nil {
+		panic(fmt.Sprintf("filelock: failed to lock key %s: %v", key, err))
+	}
+}
+
+func (l *keyLock) RUnlock(key string) {
+	l.unlock(key, false)
+}
+
+func (l *keyLock) LockContext(ctx context.Context, key string) error {
+	_, err := l.lock(ctx, key, true, true)
+	return err
+}
+
+func (l *keyLock) RLockContext(ctx context.Context, key string) error {
+	_, err := l.lock(ctx, key, false, true)
+	return err
+}
+
+func (l *keyLock) TryLock(key string) bool {
+	locked, _ := l.lock(context.Background(), key, true, false)
+	return locked
+}
+
+func (l *keyLock) TryRLock(key string) bool {
+	locked, _ := l.lock(context.Background(), key, false, false)
+	return locked
+}
+
+// lock locks the file of the given key, polling with an increasing period while it is locked by
+// someone else if wait is set.
+func (l *keyLock) lock(ctx context.Context, key string, write, wait bool) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	path := filepath.Join(l.dir, FileName(key))
+	period := minPollPeriod
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+		if err != nil {
+			return false, err
+		}
+		for {
+			err = lockFile(f, write)
+			if !errors.Is(err, errWouldBlock) || !wait {
+				break
+			}
+			select {
+			case <-time.After(period):
+			case <-ctx.Done():
+				_ = f.Close()
+				return false, ctx.Err()
+			}
+			period = min(2*period, maxPollPeriod)
+		}
+		if err != nil {
+			_ = f.Close()
+			if errors.Is(err, errWouldBlock) {
+				return false, nil
+			}
+			return false, err
+		}
+		if !removed(f, path) {
+			l.guard.Lock()
+			l.held[key] = append(l.held[key], &heldFile{file: f, write: write})
+			l.guard.Unlock()
+			return true, nil
+		}
+		// the file has been removed by its previous holder or a cleanup while we were waiting for it
+		_ = unlockFile(f)
+		_ = f.Close()
+	}
+}
+
+func (l *keyLock) unlock(key string, write bool) {
+	l.guard.Lock()
+	held := l.held[key]
+	i := -1
+	for j, h := range held {
+		if h.write == write {
+			i = j
+			break
+		}
+	}
+	if i < 0 {
+		l.guard.Unlock()
+		panic(fmt.Sprintf("filelock: unlock of unlocked key %s", key))
+	}
+	h := held[i]
+	if held = append(held[:i], held[i+1:]...); len(held) == 0 {
+		delete(l.held, key)
+	} else {
+		l.held[key] = held
+	}
+	l.guard.Unlock()
+
+	release(h.file, filepath.Join(l.dir, FileName(key)), write)
+}
+
+// release unlocks and closes f, removing it if nobody else holds or waits for it.
+func release(f *os.File, path string, write bool) {
+	defer func() {
+		_ = f.Close()
+	}()
+	if !write {
+		// readers can only remove the file once no other reader holds it
+		if err := unlockFile(f); err != nil {
+			return
+		}
+		if err := lockFile(f, true); err != nil {
+			return
+		}
+	}
+	// waiters which have already opened the file notice the removal once they lock it
+	_ = os.Remove(path)
+	_ = unlockFile(f)
+}
+
+// removed reports whether the locked file f is no longer the file at path.
+func removed(f *os.File, path string) bool {
+	locked, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(locked, current)
+}
+
+// Cleanup removes the lock files in dir which have not been modified for olderThan and are not
+// locked, e.g. those left behind by processes which died while holding a lock. It is safe to call
+// while the directory is in use and returns the number of files removed.
+func Cleanup(dir string, olderThan time.Duration) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), lockFileSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < olderThan {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			continue
+		}
+		if err := lockFile(f, true); err != nil {
+			_ = f.Close()
+			continue
+		}
+		if !removed(f, path) && os.Remove(path) == nil {
+			count++
+		}
+		_ = unlockFile(f)
+		_ = f.Close()
+	}
+	return count, nil
+}
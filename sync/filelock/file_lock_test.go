@@ -0,0 +1,160 @@
+package filelock
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	helperDirEnv = "FILELOCK_TEST_HELPER_DIR"
+	helperLogEnv = "FILELOCK_TEST_HELPER_LOG"
+	iterations   = 20
+)
+
+// TestHelperProcess is run in child processes by TestLockAcrossProcesses. Each child repeatedly
+// locks the same key and logs when it enters and leaves the critical section.
+func TestHelperProcess(t *testing.T) {
+	dir := os.Getenv(helperDirEnv)
+	if dir == "" {
+		t.Skip("only run as a child process")
+	}
+	l, err := NewKeyLock(dir)
+	require.NoError(t, err)
+	logFile, err := os.OpenFile(os.Getenv(helperLogEnv), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	defer logFile.Close()
+
+	pid := os.Getpid()
+	for range iterations {
+		l.Lock("my-repo")
+		_, err = fmt.Fprintf(logFile, "begin %d\n", pid)
+		require.NoError(t, err)
+		time.Sleep(time.Millisecond)
+		_, err = fmt.Fprintf(logFile, "end %d\n", pid)
+		require.NoError(t, err)
+		l.Unlock("my-repo")
+	}
+}
+
+func TestLockAcrossProcesses(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(t.TempDir(), "log")
+	require.NoError(t, os.WriteFile(logPath, nil, 0o644))
+
+	var children []*exec.Cmd
+	for range 4 {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+		cmd.Env = append(os.Environ(), helperDirEnv+"="+dir, helperLogEnv+"="+logPath)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		require.NoError(t, cmd.Start())
+		children = append(children, cmd)
+	}
+	for _, cmd := range children {
+		require.NoError(t, cmd.Wait())
+	}
+
+	f, err := os.Open(logPath)
+	require.NoError(t, err)
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	require.NoError(t, scanner.Err())
+
+	// the critical sections of the children never overlap
+	require.Len(t, lines, 4*iterations*2)
+	for i := 0; i < len(lines); i += 2 {
+		begin, end := strings.Fields(lines[i]), strings.Fields(lines[i+1])
+		require.Equal(t, "begin", begin[0], lines[i])
+		require.Equal(t, "end", end[0], lines[i+1])
+		require.Equal(t, begin[1], end[1])
+	}
+
+	// all lock files have been removed again
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLockInProcess(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewKeyLock(dir)
+	require.NoError(t, err)
+
+	l.Lock("my-repo")
+	assert.FileExists(t, filepath.Join(dir, FileName("my-repo")))
+	assert.False(t, l.TryLock("my-repo"))
+	assert.False(t, l.TryRLock("my-repo"))
+	assert.True(t, l.TryLock("other-repo"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.LockContext(ctx, "my-repo"), context.DeadlineExceeded)
+
+	done := make(chan error)
+	go func() {
+		done <- l.RLockContext(context.Background(), "my-repo")
+	}()
+	l.Unlock("my-repo")
+	require.NoError(t, <-done)
+	assert.True(t, l.TryRLock("my-repo"))
+	assert.False(t, l.TryLock("my-repo"))
+
+	l.RUnlock("my-repo")
+	assert.FileExists(t, filepath.Join(dir, FileName("my-repo")))
+	l.RUnlock("my-repo")
+	l.Unlock("other-repo")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.Panics(t, func() {
+		l.Unlock("my-repo")
+	})
+}
+
+func TestCleanup(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewKeyLock(dir)
+	require.NoError(t, err)
+
+	// lock files left behind by a process which died
+	for i := range 3 {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, FileName("stale-"+strconv.Itoa(i))), nil, 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "unrelated"), nil, 0o644))
+	l.Lock("my-repo")
+
+	removed, err := Cleanup(dir, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, err = Cleanup(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{FileName("my-repo"), "unrelated"}, names)
+
+	l.Unlock("my-repo")
+}
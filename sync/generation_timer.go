@@ -0,0 +1,39 @@
+package sync
+
+import (
+	"time"
+
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+// generationTimer is a timer which can be rescheduled and stopped reliably. A stopped timer may
+// already be about to fire, so every schedule is identified by a generation and the callback has to
+// check with current, under the same mutex guarding schedule and stop, that it still is the most
+// recent one.
+type generationTimer struct {
+	timer      argotime.Timer
+	generation uint64
+}
+
+// schedule stops the timer and schedules f to be called on its own goroutine with the new
+// generation after d.
+func (t *generationTimer) schedule(clk argotime.Clock, d time.Duration, f func(generation uint64)) {
+	t.stop()
+	generation := t.generation
+	t.timer = clk.AfterFunc(d, func() {
+		f(generation)
+	})
+}
+
+// stop stops the timer, so that a callback which is already about to be called is no longer current.
+func (t *generationTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	t.generation++
+}
+
+// current reports whether generation identifies the most recent schedule which has not been stopped.
+func (t *generationTimer) current(generation uint64) bool {
+	return t.timer != nil && t.generation == generation
+}
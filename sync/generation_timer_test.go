@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+func TestGenerationTimer(t *testing.T) {
+	clock := argotime.NewFakeClock(time.Now())
+	var guard sync.Mutex
+	var timer generationTimer
+	fired := make(chan bool, 10)
+	schedule := func(d time.Duration) {
+		guard.Lock()
+		defer guard.Unlock()
+		timer.schedule(clock, d, func(generation uint64) {
+			guard.Lock()
+			defer guard.Unlock()
+			fired <- timer.current(generation)
+		})
+	}
+
+	schedule(time.Second)
+	clock.Step(time.Second)
+	assert.True(t, <-fired)
+
+	// a rescheduled timer only fires for its latest schedule
+	schedule(time.Second)
+	clock.Step(500 * time.Millisecond)
+	schedule(time.Second)
+	clock.Step(time.Second)
+	assert.True(t, <-fired)
+
+	// a callback which was about to be called when the timer was stopped is no longer current
+	guard.Lock()
+	timer.schedule(clock, time.Second, func(generation uint64) {
+		guard.Lock()
+		defer guard.Unlock()
+		fired <- timer.current(generation)
+	})
+	clock.Step(time.Second)
+	timer.stop()
+	guard.Unlock()
+	assert.False(t, <-fired)
+	assert.Empty(t, fired)
+}
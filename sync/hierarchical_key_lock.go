@@ -0,0 +1,271 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// lockMode is a mode of the multiple granularity locking protocol used by hierarchicalKeyLock.
+type lockMode int
+
+const (
+	// intentionShared is held on the ancestors of a read-locked key
+	intentionShared lockMode = iota
+	// intentionExclusive is held on the ancestors of a write-locked key
+	intentionExclusive
+	shared
+	exclusive
+)
+
+// lockModeCompatible reports which modes may be held on the same key at the same time.
+var lockModeCompatible = [4][4]bool{
+	intentionShared:    {intentionShared: true, intentionExclusive: true, shared: true},
+	intentionExclusive: {intentionShared: true, intentionExclusive: true},
+	shared:             {intentionShared: true, shared: true},
+	exclusive:          {},
+}
+
+type modeWaiter struct {
+	mode  lockMode
+	ready chan struct{}
+}
+
+// modeEntry is the state of a single key of a hierarchicalKeyLock: the number of holders per mode
+// and the queue of waiters.
+type modeEntry struct {
+	granted [4]int
+	waiters []*modeWaiter
+}
+
+func (e *modeEntry) idle() bool {
+	return e.granted == [4]int{} && len(e.waiters) == 0
+}
+
+func (e *modeEntry) compatible(mode lockMode) bool {
+	for held, n := range e.granted {
+		if n > 0 && !lockModeCompatible[mode][held] {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *modeEntry) tryAcquire(mode lockMode) bool {
+	if len(e.waiters) > 0 || !e.compatible(mode) {
+		return false
+	}
+	e.granted[mode]++
+	return true
+}
+
+func (e *modeEntry) release(mode lockMode) {
+	if e.granted[mode] == 0 {
+		panic("sync: unlock of unlocked key")
+	}
+	e.granted[mode]--
+}
+
+func (e *modeEntry) grant() {
+	for len(e.waiters) > 0 {
+		w := e.waiters[0]
+		if !e.compatible(w.mode) {
+			return
+		}
+		e.granted[w.mode]++
+		e.waiters[0] = nil
+		e.waiters = e.waiters[1:]
+		close(w.ready)
+	}
+}
+
+func (e *modeEntry) cancel(w *modeWaiter) {
+	for i := range e.waiters {
+		if e.waiters[i] == w {
+			e.waiters = append(e.waiters[:i], e.waiters[i+1:]...)
+			e.grant()
+			return
+		}
+	}
+	// the lock was handed over while the context got cancelled, pass it on
+	e.release(w.mode)
+	e.grant()
+}
+
+type hierarchicalKeyLock struct {
+	separator string
+
+	guard sync.Mutex
+	locks map[string]*modeEntry
+}
+
+// NewHierarchicalKeyLock returns a KeyLock for keys which form a hierarchy of paths, such as
+// "cluster/ns/app" when split by separator "/". Locking a key also locks all its descendants: a write
+// lock on "cluster/ns" excludes readers and writers of "cluster/ns/app", and a read lock on it
+// excludes writers of "cluster/ns/app". Keys are locked top-down with intention locks on their
+// ancestors, which keeps concurrent acquisitions deadlock-free. A key must not be locked together
+// with one of its descendants by the same goroutine, e.g. with LockAll. It panics if separator is
+// empty.
+func NewHierarchicalKeyLock(separator string) KeyLock[string] {
+	if separator == "" {
+		panic("sync: NewHierarchicalKeyLock requires a non-empty separator")
+	}
+	return &hierarchicalKeyLock{
+		separator: separator,
+		locks:     map[string]*modeEntry{},
+	}
+}
+
+// path returns the key and its ancestors, root first.
+func (l *hierarchicalKeyLock) path(key string) []string {
+	segments := strings.Split(key, l.separator)
+	path := make([]string, len(segments))
+	for i := range segments {
+		path[i] = strings.Join(segments[:i+1], l.separator)
+	}
+	return path
+}
+
+// modes returns the modes to acquire on the ancestors and on the key itself.
+func modes(write bool) (ancestors, key lockMode) {
+	if write {
+		return intentionExclusive, exclusive
+	}
+	return intentionShared, shared
+}
+
+func (l *hierarchicalKeyLock) lock(ctx context.Context, key string, write bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ancestorMode, keyMode := modes(write)
+	path := l.path(key)
+	for i, p := range path {
+		mode := ancestorMode
+		if i == len(path)-1 {
+			mode = keyMode
+		}
+		if err := l.acquire(ctx, p, mode); err != nil {
+			l.releasePath(path[:i], ancestorMode, keyMode, false)
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *hierarchicalKeyLock) acquire(ctx context.Context, key string, mode lockMode) error {
+	l.guard.Lock()
+	entry, ok := l.locks[key]
+	if !ok {
+		entry = &modeEntry{}
+		l.locks[key] = entry
+	}
+	if entry.tryAcquire(mode) {
+		l.guard.Unlock()
+		return nil
+	}
+	w := &modeWaiter{mode: mode, ready: make(chan struct{})}
+	entry.waiters = append(entry.waiters, w)
+	l.guard.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	entry.cancel(w)
+	if entry.idle() {
+		delete(l.locks, key)
+	}
+	return ctx.Err()
+}
+
+func (l *hierarchicalKeyLock) tryLock(key string, write bool) bool {
+	ancestorMode, keyMode := modes(write)
+	path := l.path(key)
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	for i, p := range path {
+		mode := ancestorMode
+		if i == len(path)-1 {
+			mode = keyMode
+		}
+		entry, ok := l.locks[p]
+		if !ok {
+			entry = &modeEntry{}
+		}
+		if !entry.tryAcquire(mode) {
+			l.releasePathLocked(path[:i], ancestorMode, keyMode, false)
+			return false
+		}
+		l.locks[p] = entry
+	}
+	return true
+}
+
+func (l *hierarchicalKeyLock) unlock(key string, write bool) {
+	ancestorMode, keyMode := modes(write)
+	l.releasePath(l.path(key), ancestorMode, keyMode, true)
+}
+
+// releasePath releases the given path bottom-up. If complete is set, the last element of the path is
+// the key itself rather than an ancestor.
+func (l *hierarchicalKeyLock) releasePath(path []string, ancestorMode, keyMode lockMode, complete bool) {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	l.releasePathLocked(path, ancestorMode, keyMode, complete)
+}
+
+func (l *hierarchicalKeyLock) releasePathLocked(path []string, ancestorMode, keyMode lockMode, complete bool) {
+	for i := len(path) - 1; i >= 0; i-- {
+		mode := ancestorMode
+		if complete && i == len(path)-1 {
+			mode = keyMode
+		}
+		entry, ok := l.locks[path[i]]
+		if !ok {
+			panic(fmt.Sprintf("sync: unlock of unlocked key %s", path[i]))
+		}
+		entry.release(mode)
+		entry.grant()
+		if entry.idle() {
+			delete(l.locks, path[i])
+		}
+	}
+}
+
+func (l *hierarchicalKeyLock) Lock(key string) {
+	_ = l.lock(context.Background(), key, true)
+}
+
+func (l *hierarchicalKeyLock) Unlock(key string) {
+	l.unlock(key, true)
+}
+
+func (l *hierarchicalKeyLock) RLock(key string) {
+	_ = l.lock(context.Background(), key, false)
+}
+
+func (l *hierarchicalKeyLock) RUnlock(key string) {
+	l.unlock(key, false)
+}
+
+func (l *hierarchicalKeyLock) LockContext(ctx context.Context, key string) error {
+	return l.lock(ctx, key, true)
+}
+
+func (l *hierarchicalKeyLock) RLockContext(ctx context.Context, key string) error {
+	return l.lock(ctx, key, false)
+}
+
+func (l *hierarchicalKeyLock) TryLock(key string) bool {
+	return l.tryLock(key, true)
+}
+
+func (l *hierarchicalKeyLock) TryRLock(key string) bool {
+	return l.tryLock(key, false)
+}
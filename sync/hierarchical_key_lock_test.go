@@ -0,0 +1,136 @@
+package sync
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHierarchicalKeyLockDescendants(t *testing.T) {
+	l := NewHierarchicalKeyLock("/")
+
+	l.Lock("cluster/ns")
+	assert.False(t, l.TryLock("cluster/ns/app"))
+	assert.False(t, l.TryRLock("cluster/ns/app"))
+	assert.False(t, l.TryRLock("cluster"))
+	assert.True(t, l.TryLock("cluster/other-ns/app"))
+	assert.True(t, l.TryLock("cluster/nsx"))
+	l.Unlock("cluster/ns")
+
+	assert.True(t, l.TryLock("cluster/ns/app"))
+	l.Unlock("cluster/ns/app")
+	l.Unlock("cluster/other-ns/app")
+	l.Unlock("cluster/nsx")
+
+	assert.Empty(t, l.(*hierarchicalKeyLock).locks)
+
+	assert.Panics(t, func() {
+		NewHierarchicalKeyLock("")
+	})
+}
+
+func TestHierarchicalKeyLockAncestors(t *testing.T) {
+	l := NewHierarchicalKeyLock("/")
+
+	l.Lock("cluster/ns/app")
+	assert.False(t, l.TryLock("cluster/ns"))
+	assert.False(t, l.TryRLock("cluster"))
+	assert.True(t, l.TryLock("cluster/ns/other-app"))
+	l.Unlock("cluster/ns/other-app")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.LockContext(ctx, "cluster"), context.DeadlineExceeded)
+
+	l.Unlock("cluster/ns/app")
+	assert.True(t, l.TryLock("cluster"))
+	l.Unlock("cluster")
+
+	assert.Empty(t, l.(*hierarchicalKeyLock).locks)
+}
+
+func TestHierarchicalKeyLockReaders(t *testing.T) {
+	l := NewHierarchicalKeyLock("/")
+
+	l.RLock("cluster/ns")
+	assert.True(t, l.TryRLock("cluster/ns/app"))
+	assert.False(t, l.TryLock("cluster/ns/other-app"))
+	assert.True(t, l.TryLock("cluster/other-ns"))
+	assert.False(t, l.TryLock("cluster"))
+	// reading the whole cluster conflicts with the write lock on one of its namespaces
+	assert.False(t, l.TryRLock("cluster"))
+	l.Unlock("cluster/other-ns")
+	require.NoError(t, l.RLockContext(context.Background(), "cluster"))
+
+	l.RUnlock("cluster")
+	l.RUnlock("cluster/ns/app")
+	l.RUnlock("cluster/ns")
+
+	assert.Empty(t, l.(*hierarchicalKeyLock).locks)
+}
+
+func TestHierarchicalKeyLockPartialFailure(t *testing.T) {
+	l := NewHierarchicalKeyLock("/")
+
+	l.Lock("cluster/ns/app")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.LockContext(ctx, "cluster/ns/app/child"), context.DeadlineExceeded)
+
+	l.Unlock("cluster/ns/app")
+	assert.Empty(t, l.(*hierarchicalKeyLock).locks)
+}
+
+func TestHierarchicalKeyLockConcurrent(t *testing.T) {
+	l := NewHierarchicalKeyLock("/")
+	keys := []string{"c", "c/a", "c/b", "c/a/x", "c/a/y", "c/b/x"}
+
+	// every write lock excludes writes to its whole subtree, so the counters of a subtree are only
+	// ever touched by one writer at a time
+	counters := map[string]*int{}
+	for _, key := range keys {
+		counters[key] = new(int)
+	}
+	descendants := func(key string) []string {
+		var result []string
+		for _, k := range keys {
+			if k == key || len(k) > len(key) && k[:len(key)+1] == key+"/" {
+				result = append(result, k)
+			}
+		}
+		return result
+	}
+
+	wg := sync.WaitGroup{}
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 500 {
+				key := keys[rand.IntN(len(keys))]
+				if rand.IntN(2) == 0 {
+					l.RLock(key)
+					for _, k := range descendants(key) {
+						_ = *counters[k]
+					}
+					l.RUnlock(key)
+				} else {
+					l.Lock(key)
+					for _, k := range descendants(key) {
+						*counters[k]++
+					}
+					l.Unlock(key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, l.(*hierarchicalKeyLock).locks)
+}
@@ -0,0 +1,285 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultDurationBuckets are the upper bounds of the wait and hold time histograms recorded by an
+// InstrumentedKeyLock.
+var DefaultDurationBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// Histogram is a histogram of durations. Counts[i] is the number of observations less than or equal
+// to Buckets[i] and greater than the previous bucket; the last element of Counts holds the
+// observations greater than all buckets.
+type Histogram struct {
+	Buckets []time.Duration
+	Counts  []uint64
+	Count   uint64
+	Sum     time.Duration
+}
+
+func newHistogram(buckets []time.Duration) Histogram {
+	return Histogram{
+		Buckets: buckets,
+		Counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	h.Counts[sort.Search(len(h.Buckets), func(i int) bool { return d <= h.Buckets[i] })]++
+	h.Count++
+	h.Sum += d
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = slices.Clone(h.Counts)
+	return h
+}
+
+// KeyLockStats are the durations recorded for the acquisitions of a key.
+type KeyLockStats struct {
+	// Wait is the time it took to acquire the lock.
+	Wait Histogram
+	// Hold is the time the lock was held for.
+	Hold Histogram
+}
+
+// Holder describes an acquisition of a key lock which has not been released yet.
+type Holder[K comparable] struct {
+	Key   K
+	Write bool
+	// Goroutine is the ID of the goroutine which acquired the lock.
+	Goroutine uint64
+	// Caller is the file:line the lock was acquired from.
+	Caller string
+	Since  time.Time
+}
+
+// InstrumentedKeyLock is a KeyLock which records wait and hold time histograms per key and keeps
+// track of the goroutines currently holding a lock. At most maxKeys keys get their own
+// histograms, the acquisitions of all other keys are recorded together.
+type InstrumentedKeyLock[K comparable] struct {
+	inner   KeyLock[K]
+	maxKeys int
+	buckets []time.Duration
+
+	guard   sync.Mutex
+	holders map[K][]*Holder[K]
+	stats   map[K]*KeyLockStats
+	other   *KeyLockStats
+}
+
+// NewInstrumentedKeyLock returns an InstrumentedKeyLock which records the acquisitions of l.
+func NewInstrumentedKeyLock[K comparable](l KeyLock[K], maxKeys int) *InstrumentedKeyLock[K] {
+	return &InstrumentedKeyLock[K]{
+		inner:   l,
+		maxKeys: maxKeys,
+		buckets: DefaultDurationBuckets,
+		holders: map[K][]*Holder[K]{},
+		stats:   map[K]*KeyLockStats{},
+	}
+}
+
+func (l *InstrumentedKeyLock[K]) Lock(key K) {
+	start := time.Now()
+	l.inner.Lock(key)
+	l.acquired(key, true, start, callerOf(1))
+}
+
+func (l *InstrumentedKeyLock[K]) Unlock(key K) {
+	l.released(key, true)
+	l.inner.Unlock(key)
+}
+
+func (l *InstrumentedKeyLock[K]) RLock(key K) {
+	start := time.Now()
+	l.inner.RLock(key)
+	l.acquired(key, false, start, callerOf(1))
+}
+
+func (l *InstrumentedKeyLock[K]) RUnlock(key K) {
+	l.released(key, false)
+	l.inner.RUnlock(key)
+}
+
+func (l *InstrumentedKeyLock[K]) LockContext(ctx context.Context, key K) error {
+	start := time.Now()
+	if err := l.inner.LockContext(ctx, key); err != nil {
+		return err
+	}
+	l.acquired(key, true, start, callerOf(1))
+	return nil
+}
+
+func (l *InstrumentedKeyLock[K]) RLockContext(ctx context.Context, key K) error {
+	start := time.Now()
+	if err := l.inner.RLockContext(ctx, key); err != nil {
+		return err
+	}
+	l.acquired(key, false, start, callerOf(1))
+	return nil
+}
+
+func (l *InstrumentedKeyLock[K]) TryLock(key K) bool {
+	start := time.Now()
+	if !l.inner.TryLock(key) {
+		return false
+	}
+	l.acquired(key, true, start, callerOf(1))
+	return true
+}
+
+func (l *InstrumentedKeyLock[K]) TryRLock(key K) bool {
+	start := time.Now()
+	if !l.inner.TryRLock(key) {
+		return false
+	}
+	l.acquired(key, false, start, callerOf(1))
+	return true
+}
+
+// Held returns the acquisitions which have not been released yet, longest held first.
+func (l *InstrumentedKeyLock[K]) Held() []Holder[K] {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	var held []Holder[K]
+	for _, holders := range l.holders {
+		for _, h := range holders {
+			held = append(held, *h)
+		}
+	}
+	slices.SortFunc(held, func(a, b Holder[K]) int {
+		return a.Since.Compare(b.Since)
+	})
+	return held
+}
+
+// Stats returns the histograms recorded per key, as well as those recorded for all keys beyond the
+// cardinality limit.
+func (l *InstrumentedKeyLock[K]) Stats() (perKey map[K]KeyLockStats, other KeyLockStats) {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	perKey = make(map[K]KeyLockStats, len(l.stats))
+	for key, s := range l.stats {
+		perKey[key] = KeyLockStats{Wait: s.Wait.clone(), Hold: s.Hold.clone()}
+	}
+	if l.other != nil {
+		other = KeyLockStats{Wait: l.other.Wait.clone(), Hold: l.other.Hold.clone()}
+	}
+	return perKey, other
+}
+
+// LogHeld logs the acquisitions which have not been released yet. It complements stats.LogStack when
+// diagnosing a stalled process.
+func (l *InstrumentedKeyLock[K]) LogHeld() {
+	now := time.Now()
+	var b strings.Builder
+	for _, h := range l.Held() {
+		fmt.Fprintf(&b, "key=%v write=%t goroutine=%d caller=%s held=%s\n", h.Key, h.Write, h.Goroutine, h.Caller, now.Sub(h.Since))
+	}
+	log.Infof("*** held key locks...\n%s*** end\n", b.String())
+}
+
+func (l *InstrumentedKeyLock[K]) acquired(key K, write bool, start time.Time, caller string) {
+	now := time.Now()
+	h := &Holder[K]{Key: key, Write: write, Goroutine: goroutineID(), Caller: caller, Since: now}
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	l.holders[key] = append(l.holders[key], h)
+	l.statsFor(key).Wait.observe(now.Sub(start))
+}
+
+// released drops the holder of the given acquisition.
+func (l *InstrumentedKeyLock[K]) released(key K, write bool) {
+	gid := goroutineID()
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	holders := l.holders[key]
+	i := findHolder(holders, func(h *Holder[K]) *Holder[K] { return h }, write, gid)
+	if i < 0 {
+		// not acquired through this lock, the inner lock decides what happens
+		return
+	}
+	l.statsFor(key).Hold.observe(time.Since(holders[i].Since))
+	holders = slices.Delete(holders, i, i+1)
+	if len(holders) == 0 {
+		delete(l.holders, key)
+	} else {
+		l.holders[key] = holders
+	}
+}
+
+func (l *InstrumentedKeyLock[K]) statsFor(key K) *KeyLockStats {
+	if s, ok := l.stats[key]; ok {
+		return s
+	}
+	if len(l.stats) < l.maxKeys {
+		s := &KeyLockStats{Wait: newHistogram(l.buckets), Hold: newHistogram(l.buckets)}
+		l.stats[key] = s
+		return s
+	}
+	if l.other == nil {
+		l.other = &KeyLockStats{Wait: newHistogram(l.buckets), Hold: newHistogram(l.buckets)}
+	}
+	return l.other
+}
+
+// findHolder returns the index of the acquisition which is released by a call to Unlock (write) or
+// RUnlock from goroutine gid, or -1 if there is none. Readers are matched by goroutine where possible,
+// as any of them may release the lock first.
+func findHolder[H any, K comparable](holders []H, holder func(H) *Holder[K], write bool, gid uint64) int {
+	i := slices.IndexFunc(holders, func(h H) bool {
+		return holder(h).Write == write && holder(h).Goroutine == gid
+	})
+	if i < 0 {
+		i = slices.IndexFunc(holders, func(h H) bool {
+			return holder(h).Write == write
+		})
+	}
+	return i
+}
+
+// goroutineID returns the ID of the calling goroutine as printed in its stack trace.
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	// the trace starts with "goroutine <id> [<status>]:"
+	fields := bytes.Fields(buf[:n])
+	if len(fields) < 2 {
+		return 0
+	}
+	id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+	return id
+}
+
+// callerOf returns the file:line of the caller skip frames above the function calling callerOf.
+func callerOf(skip int) string {
+	_, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
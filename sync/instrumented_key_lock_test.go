@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedKeyLockHeld(t *testing.T) {
+	l := NewInstrumentedKeyLock(NewKeyLock(), 10)
+
+	l.Lock("my-key")
+	require.True(t, l.TryRLock("other-key"))
+	require.NoError(t, l.RLockContext(context.Background(), "other-key"))
+
+	held := l.Held()
+	require.Len(t, held, 3)
+	assert.Equal(t, "my-key", held[0].Key)
+	assert.True(t, held[0].Write)
+	assert.Equal(t, goroutineID(), held[0].Goroutine)
+	assert.Contains(t, held[0].Caller, "instrumented_key_lock_test.go:")
+	assert.Equal(t, "other-key", held[1].Key)
+	assert.False(t, held[1].Write)
+
+	l.Unlock("my-key")
+	l.RUnlock("other-key")
+	assert.Len(t, l.Held(), 1)
+	l.RUnlock("other-key")
+	assert.Empty(t, l.Held())
+	assert.Empty(t, l.holders)
+}
+
+func TestInstrumentedKeyLockStats(t *testing.T) {
+	inner := NewKeyLock()
+	l := NewInstrumentedKeyLock(inner, 1)
+
+	l.Lock("my-key")
+	done := make(chan struct{})
+	go func() {
+		l.Lock("my-key")
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		return waiters(inner, "my-key") == 1
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	l.Unlock("my-key")
+	<-done
+	l.Unlock("my-key")
+
+	l.RLock("other-key")
+	l.RUnlock("other-key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Error(t, l.LockContext(ctx, "my-key"))
+
+	perKey, other := l.Stats()
+	require.Len(t, perKey, 1)
+	s := perKey["my-key"]
+	assert.Equal(t, uint64(2), s.Wait.Count)
+	assert.Equal(t, uint64(2), s.Hold.Count)
+	assert.GreaterOrEqual(t, s.Wait.Sum, 20*time.Millisecond)
+	assert.GreaterOrEqual(t, s.Hold.Sum, 20*time.Millisecond)
+	assert.Len(t, s.Wait.Counts, len(DefaultDurationBuckets)+1)
+
+	assert.Equal(t, uint64(1), other.Wait.Count)
+	assert.Equal(t, uint64(1), other.Hold.Count)
+}
+
+func TestInstrumentedKeyLockLogHeld(t *testing.T) {
+	l := NewInstrumentedKeyLock(NewKeyLock(), 10)
+
+	var buf bytes.Buffer
+	out := log.StandardLogger().Out
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+
+	l.Lock("my-key")
+	l.LogHeld()
+	l.Unlock("my-key")
+
+	assert.Contains(t, buf.String(), "key=my-key write=true")
+}
+
+func TestHistogramObserve(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, time.Second})
+
+	h.observe(0)
+	h.observe(time.Millisecond)
+	h.observe(time.Second)
+	h.observe(time.Minute)
+
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(4), h.Count)
+	assert.Equal(t, time.Minute+time.Second+time.Millisecond, h.Sum)
+}
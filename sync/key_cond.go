@@ -0,0 +1,136 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// KeyCond is a condition variable per key, integrated with a KeyLock. It wraps the KeyLock, so
+// goroutines waiting for a key are woken whenever its write lock is released through the KeyCond,
+// e.g. to wait until the sync of an application has finished:
+//
+//	c.Lock(app)
+//	for syncing(app) {
+//		if err := c.Wait(ctx, app); err != nil {
+//			c.Unlock(app)
+//			return err
+//		}
+//	}
+//	c.Unlock(app)
+//
+// Entries are removed as soon as nobody waits for a key.
+type KeyCond[K comparable] struct {
+	locks KeyLock[K]
+
+	guard   sync.Mutex
+	waiters map[K][]chan struct{}
+}
+
+var _ KeyLock[string] = &KeyCond[string]{}
+
+// NewKeyCond returns a KeyCond for the keys of l.
+func NewKeyCond[K comparable](l KeyLock[K]) *KeyCond[K] {
+	return &KeyCond[K]{
+		locks:   l,
+		waiters: map[K][]chan struct{}{},
+	}
+}
+
+// Wait atomically releases the write lock on key held by the caller and suspends the calling
+// goroutine until it is woken by Signal, Broadcast or Unlock of key, or ctx is done. The write lock
+// is re-acquired before Wait returns, even if it returns the context's error.
+func (c *KeyCond[K]) Wait(ctx context.Context, key K) error {
+	ch := make(chan struct{})
+	c.guard.Lock()
+	c.waiters[key] = append(c.waiters[key], ch)
+	c.guard.Unlock()
+
+	c.locks.Unlock(key)
+	defer c.locks.Lock(key)
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+	}
+
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	waiters := c.waiters[key]
+	if i := slices.Index(waiters, ch); i >= 0 {
+		c.setWaiters(key, slices.Delete(waiters, i, i+1))
+	} else {
+		// signalled while the context got cancelled, pass the signal on
+		c.signalLocked(key)
+	}
+	return ctx.Err()
+}
+
+// Signal wakes the goroutine waiting the longest for key, if any.
+func (c *KeyCond[K]) Signal(key K) {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	c.signalLocked(key)
+}
+
+// Broadcast wakes all goroutines waiting for key.
+func (c *KeyCond[K]) Broadcast(key K) {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	for _, ch := range c.waiters[key] {
+		close(ch)
+	}
+	delete(c.waiters, key)
+}
+
+func (c *KeyCond[K]) signalLocked(key K) {
+	waiters := c.waiters[key]
+	if len(waiters) == 0 {
+		return
+	}
+	close(waiters[0])
+	c.setWaiters(key, waiters[1:])
+}
+
+func (c *KeyCond[K]) setWaiters(key K, waiters []chan struct{}) {
+	if len(waiters) == 0 {
+		delete(c.waiters, key)
+	} else {
+		c.waiters[key] = waiters
+	}
+}
+
+func (c *KeyCond[K]) Lock(key K) {
+	c.locks.Lock(key)
+}
+
+// Unlock releases the write lock on key and wakes all goroutines waiting for it.
+func (c *KeyCond[K]) Unlock(key K) {
+	c.locks.Unlock(key)
+	c.Broadcast(key)
+}
+
+func (c *KeyCond[K]) RLock(key K) {
+	c.locks.RLock(key)
+}
+
+func (c *KeyCond[K]) RUnlock(key K) {
+	c.locks.RUnlock(key)
+}
+
+func (c *KeyCond[K]) LockContext(ctx context.Context, key K) error {
+	return c.locks.LockContext(ctx, key)
+}
+
+func (c *KeyCond[K]) RLockContext(ctx context.Context, key K) error {
+	return c.locks.RLockContext(ctx, key)
+}
+
+func (c *KeyCond[K]) TryLock(key K) bool {
+	return c.locks.TryLock(key)
+}
+
+func (c *KeyCond[K]) TryRLock(key K) bool {
+	return c.locks.TryRLock(key)
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func condWaiters(c *KeyCond[string], key string) int {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	return len(c.waiters[key])
+}
+
+func condKeys(c *KeyCond[string]) int {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	return len(c.waiters)
+}
+
+func TestKeyCondWokenOnUnlock(t *testing.T) {
+	c := NewKeyCond(NewKeyLock())
+
+	var syncing atomic.Bool
+	syncing.Store(true)
+
+	done := make(chan error)
+	go func() {
+		c.Lock("my-app")
+		defer c.Unlock("my-app")
+		for syncing.Load() {
+			if err := c.Wait(context.Background(), "my-app"); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	require.Eventually(t, func() bool {
+		return condWaiters(c, "my-app") == 1
+	}, time.Second, time.Millisecond)
+
+	// an unrelated unlock does not satisfy the condition, so the waiter waits again
+	c.Lock("my-app")
+	c.Unlock("my-app")
+	require.Eventually(t, func() bool {
+		return condWaiters(c, "my-app") == 1
+	}, time.Second, time.Millisecond)
+
+	c.Lock("my-app")
+	syncing.Store(false)
+	c.Unlock("my-app")
+	require.NoError(t, <-done)
+	assert.Eventually(t, func() bool {
+		return condKeys(c) == 0 && c.TryLock("my-app")
+	}, time.Second, time.Millisecond)
+}
+
+func TestKeyCondSignal(t *testing.T) {
+	c := NewKeyCond(NewKeyLock())
+
+	var woken atomic.Int32
+	wg := sync.WaitGroup{}
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Lock("my-app")
+			assert.NoError(t, c.Wait(context.Background(), "my-app"))
+			woken.Add(1)
+			c.locks.Unlock("my-app")
+		}()
+		require.Eventually(t, func() bool {
+			return condWaiters(c, "my-app") == i+1
+		}, time.Second, time.Millisecond)
+	}
+
+	c.Signal("my-app")
+	require.Eventually(t, func() bool {
+		return woken.Load() == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 2, condWaiters(c, "my-app"))
+
+	c.Signal("other-app")
+	c.Broadcast("my-app")
+	wg.Wait()
+	assert.Equal(t, int32(3), woken.Load())
+	assert.Zero(t, condKeys(c))
+}
+
+func TestKeyCondWaitContext(t *testing.T) {
+	c := NewKeyCond(NewKeyLock())
+
+	c.Lock("my-app")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, c.Wait(ctx, "my-app"), context.DeadlineExceeded)
+
+	// the lock is held again after a failed wait
+	assert.False(t, c.TryRLock("my-app"))
+	c.Unlock("my-app")
+	assert.Zero(t, condKeys(c))
+}
@@ -0,0 +1,199 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+var (
+	// ErrLeaseExpired is returned when renewing or releasing a KeyLease which has been
+	// force-released because its TTL passed.
+	ErrLeaseExpired = errors.New("key lease expired")
+	// ErrLeaseReleased is returned when renewing or releasing a KeyLease which has already been
+	// released.
+	ErrLeaseReleased = errors.New("key lease released")
+)
+
+// KeyLeases grants exclusive leases on keys which are force-released once their TTL passes without
+// being renewed, so a holder which crashed or hangs cannot keep a key locked forever. Keys are
+// granted to their waiters in FIFO order and forgotten as soon as they are neither held nor waited
+// for.
+type KeyLeases[K comparable] struct {
+	clock    argotime.Clock
+	onExpire func(key K)
+
+	guard  sync.Mutex
+	leases map[K]*leaseEntry[K]
+}
+
+type leaseEntry[K comparable] struct {
+	lockEntry
+	holder *KeyLease[K]
+}
+
+// KeyLease is a lease on a key held by the goroutine which acquired it.
+type KeyLease[K comparable] struct {
+	leases *KeyLeases[K]
+	key    K
+
+	// the fields below are guarded by leases.guard
+	deadline time.Time
+	timer    generationTimer
+	// err is nil while the lease is held and ErrLeaseExpired or ErrLeaseReleased afterwards
+	err error
+}
+
+// NewKeyLeases returns KeyLeases which call onExpire, if not nil, for every key force-released
+// because its lease expired.
+func NewKeyLeases[K comparable](onExpire func(key K)) *KeyLeases[K] {
+	return NewKeyLeasesWithClock(argotime.RealClock{}, onExpire)
+}
+
+// NewKeyLeasesWithClock is like NewKeyLeases but measures TTLs with the given clock.
+func NewKeyLeasesWithClock[K comparable](clk argotime.Clock, onExpire func(key K)) *KeyLeases[K] {
+	return &KeyLeases[K]{
+		clock:    clk,
+		onExpire: onExpire,
+		leases:   map[K]*leaseEntry[K]{},
+	}
+}
+
+// Acquire waits for key to be free and leases it for ttl, giving up with the context's error once
+// ctx is done.
+func (l *KeyLeases[K]) Acquire(ctx context.Context, key K, ttl time.Duration) (*KeyLease[K], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l.guard.Lock()
+	entry, ok := l.leases[key]
+	if !ok {
+		entry = &leaseEntry[K]{}
+		l.leases[key] = entry
+	}
+	if entry.tryAcquire(true, FairnessFIFO) {
+		defer l.guard.Unlock()
+		return l.hold(key, entry, ttl), nil
+	}
+	w := entry.enqueue(true)
+	l.guard.Unlock()
+
+	select {
+	case <-w.ready:
+		l.guard.Lock()
+		defer l.guard.Unlock()
+		return l.hold(key, entry, ttl), nil
+	case <-ctx.Done():
+	}
+
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	entry.cancel(w, FairnessFIFO)
+	if entry.idle() {
+		delete(l.leases, key)
+	}
+	return nil, ctx.Err()
+}
+
+// TryAcquire leases key for ttl if it is free and reports whether it did.
+func (l *KeyLeases[K]) TryAcquire(key K, ttl time.Duration) (*KeyLease[K], bool) {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	entry, ok := l.leases[key]
+	if !ok {
+		entry = &leaseEntry[K]{}
+	}
+	if !entry.tryAcquire(true, FairnessFIFO) {
+		return nil, false
+	}
+	l.leases[key] = entry
+	return l.hold(key, entry, ttl), true
+}
+
+// hold creates the lease for the key just acquired. It must be called with the guard held.
+func (l *KeyLeases[K]) hold(key K, entry *leaseEntry[K], ttl time.Duration) *KeyLease[K] {
+	lease := &KeyLease[K]{leases: l, key: key}
+	entry.holder = lease
+	lease.schedule(ttl)
+	return lease
+}
+
+// release hands the key of lease over to its next waiter. It must be called with the guard held.
+func (l *KeyLeases[K]) release(lease *KeyLease[K]) {
+	entry := l.leases[lease.key]
+	entry.holder = nil
+	entry.release(true)
+	entry.grant(FairnessFIFO)
+	if entry.idle() {
+		delete(l.leases, lease.key)
+	}
+}
+
+func (l *KeyLeases[K]) expire(lease *KeyLease[K], generation uint64) {
+	l.guard.Lock()
+	if lease.err != nil || !lease.timer.current(generation) {
+		l.guard.Unlock()
+		return
+	}
+	lease.err = ErrLeaseExpired
+	l.release(lease)
+	l.guard.Unlock()
+
+	log.WithField("key", lease.key).Warn("key lease expired, force-releasing the key")
+	if l.onExpire != nil {
+		l.onExpire(lease.key)
+	}
+}
+
+// schedule (re)starts the TTL of the lease. It must be called with the guard held.
+func (lease *KeyLease[K]) schedule(ttl time.Duration) {
+	l := lease.leases
+	lease.deadline = l.clock.Now().Add(ttl)
+	lease.timer.schedule(l.clock, ttl, func(generation uint64) {
+		l.expire(lease, generation)
+	})
+}
+
+// Key returns the leased key.
+func (lease *KeyLease[K]) Key() K {
+	return lease.key
+}
+
+// Deadline returns the time at which the lease expires unless it is renewed.
+func (lease *KeyLease[K]) Deadline() time.Time {
+	lease.leases.guard.Lock()
+	defer lease.leases.guard.Unlock()
+	return lease.deadline
+}
+
+// Renew extends the lease to ttl from now. It returns ErrLeaseExpired if the lease has already
+// expired, in which case the key may be held by somebody else by now.
+func (lease *KeyLease[K]) Renew(ttl time.Duration) error {
+	lease.leases.guard.Lock()
+	defer lease.leases.guard.Unlock()
+	if lease.err != nil {
+		return lease.err
+	}
+	lease.schedule(ttl)
+	return nil
+}
+
+// Release releases the key. It returns ErrLeaseExpired, without touching the key, if the lease has
+// already expired.
+func (lease *KeyLease[K]) Release() error {
+	lease.leases.guard.Lock()
+	defer lease.leases.guard.Unlock()
+	if lease.err != nil {
+		return lease.err
+	}
+	lease.err = ErrLeaseReleased
+	lease.timer.stop()
+	lease.leases.release(lease)
+	return nil
+}
@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+func newTestKeyLeases() (*KeyLeases[string], *argotime.FakeClock, chan string) {
+	clock := argotime.NewFakeClock(time.Now())
+	expired := make(chan string, 10)
+	l := NewKeyLeasesWithClock(clock, func(key string) {
+		expired <- key
+	})
+	return l, clock, expired
+}
+
+func leasedKeys(l *KeyLeases[string]) int {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	return len(l.leases)
+}
+
+func TestKeyLeaseRelease(t *testing.T) {
+	l, _, expired := newTestKeyLeases()
+
+	lease, ok := l.TryAcquire("my-key", time.Second)
+	require.True(t, ok)
+	assert.Equal(t, "my-key", lease.Key())
+	_, ok = l.TryAcquire("my-key", time.Second)
+	assert.False(t, ok)
+
+	require.NoError(t, lease.Release())
+	assert.ErrorIs(t, lease.Release(), ErrLeaseReleased)
+	assert.ErrorIs(t, lease.Renew(time.Second), ErrLeaseReleased)
+	assert.Zero(t, leasedKeys(l))
+	assert.Empty(t, expired)
+}
+
+func TestKeyLeaseExpire(t *testing.T) {
+	l, clock, expired := newTestKeyLeases()
+
+	lease, err := l.Acquire(context.Background(), "my-key", time.Second)
+	require.NoError(t, err)
+
+	acquired := make(chan *KeyLease[string])
+	go func() {
+		next, err := l.Acquire(context.Background(), "my-key", time.Minute)
+		assert.NoError(t, err)
+		acquired <- next
+	}()
+	require.Eventually(t, func() bool {
+		l.guard.Lock()
+		defer l.guard.Unlock()
+		return len(l.leases["my-key"].waiters) == 1
+	}, time.Second, time.Millisecond)
+
+	clock.Step(time.Second)
+	assert.Equal(t, "my-key", <-expired)
+	next := <-acquired
+
+	// the expired holder can neither renew nor release the key it lost
+	assert.ErrorIs(t, lease.Renew(time.Second), ErrLeaseExpired)
+	assert.ErrorIs(t, lease.Release(), ErrLeaseExpired)
+	_, ok := l.TryAcquire("my-key", time.Second)
+	assert.False(t, ok)
+
+	require.NoError(t, next.Release())
+	assert.Zero(t, leasedKeys(l))
+}
+
+func TestKeyLeaseRenew(t *testing.T) {
+	l, clock, expired := newTestKeyLeases()
+
+	lease, ok := l.TryAcquire("my-key", time.Second)
+	require.True(t, ok)
+	clock.Step(900 * time.Millisecond)
+	require.NoError(t, lease.Renew(time.Second))
+	assert.Equal(t, clock.Now().Add(time.Second), lease.Deadline())
+
+	// the timer of the original TTL must not expire the renewed lease
+	clock.Step(900 * time.Millisecond)
+	select {
+	case key := <-expired:
+		t.Fatalf("unexpected expiry of %s", key)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Step(100 * time.Millisecond)
+	assert.Equal(t, "my-key", <-expired)
+	require.Eventually(t, func() bool {
+		return leasedKeys(l) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestKeyLeaseAcquireContext(t *testing.T) {
+	l, _, _ := newTestKeyLeases()
+
+	lease, ok := l.TryAcquire("my-key", time.Minute)
+	require.True(t, ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := l.Acquire(ctx, "my-key", time.Second)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, lease.Release())
+	assert.Zero(t, leasedKeys(l))
+}
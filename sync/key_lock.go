@@ -1,59 +1,313 @@
 package sync
 
-import "sync"
+import (
+	"context"
+	"slices"
+	"sync"
+)
 
-type KeyLock interface {
-	Lock(key string)
-	Unlock(key string)
-	RLock(key string)
-	RUnlock(key string)
+// KeyLock is a set of read/write locks identified by keys of type K. Keys can be any comparable
+// value, so composite keys such as types.NamespacedName can be used directly.
+type KeyLock[K comparable] interface {
+	Lock(key K)
+	Unlock(key K)
+	RLock(key K)
+	RUnlock(key K)
+	// LockContext acquires the write lock for key, giving up with the context's error once ctx is done.
+	LockContext(ctx context.Context, key K) error
+	// RLockContext acquires a read lock for key, giving up with the context's error once ctx is done.
+	RLockContext(ctx context.Context, key K) error
+	// TryLock acquires the write lock for key if it is immediately available and reports whether it did.
+	TryLock(key K) bool
+	// TryRLock acquires a read lock for key if it is immediately available and reports whether it did.
+	TryRLock(key K) bool
 }
 
-type keyLock struct {
-	guard sync.RWMutex
-	locks map[string]*sync.RWMutex
+// waiter is a goroutine queued for a key. ready is closed once the lock has
+// been handed over to it.
+type waiter struct {
+	write bool
+	ready chan struct{}
 }
 
-func NewKeyLock() KeyLock {
-	return &keyLock{
-		guard: sync.RWMutex{},
-		locks: map[string]*sync.RWMutex{},
+// lockEntry is the state of a single key: the goroutines currently holding it
+// and the queue of those waiting for it. The entry is removed from the map as
+// soon as it has neither, so the map only ever contains keys which are in use.
+type lockEntry struct {
+	readers int
+	writer  bool
+	waiters []*waiter
+	// waitingWriters is the number of writers in waiters
+	waitingWriters int
+	// upgrader is a reader waiting to upgrade to the write lock, see Upgrade
+	upgrader *waiter
+}
+
+func (e *lockEntry) idle() bool {
+	return !e.writer && e.readers == 0 && len(e.waiters) == 0
+}
+
+// tryAcquire takes the lock if it is free and the policy does not require the
+// caller to queue behind the current waiters.
+func (e *lockEntry) tryAcquire(write bool, policy FairnessPolicy) bool {
+	if e.writer || e.upgrader != nil {
+		return false
+	}
+	if write {
+		if e.readers > 0 || len(e.waiters) > 0 {
+			return false
+		}
+		e.writer = true
+		return true
 	}
+	switch policy {
+	case FairnessWriterPreferring:
+		if e.waitingWriters > 0 {
+			return false
+		}
+	case FairnessReaderPreferring:
+		// readers join as long as no writer holds the lock
+	default:
+		if len(e.waiters) > 0 {
+			return false
+		}
+	}
+	e.readers++
+	return true
 }
 
-func (l *keyLock) getLock(key string) *sync.RWMutex {
-	l.guard.RLock()
-	if lock, ok := l.locks[key]; ok {
-		l.guard.RUnlock()
-		return lock
+func (e *lockEntry) release(write bool) {
+	if write {
+		if !e.writer {
+			panic("sync: Unlock of unlocked key")
+		}
+		e.writer = false
+		return
+	}
+	if e.readers == 0 {
+		panic("sync: RUnlock of unlocked key")
 	}
+	e.readers--
+}
 
-	l.guard.RUnlock()
-	l.guard.Lock()
+// grant hands the lock over to as many waiters as the current holders and the
+// policy allow.
+func (e *lockEntry) grant(policy FairnessPolicy) {
+	if e.writer {
+		return
+	}
+	if e.upgrader != nil {
+		// a pending upgrade takes precedence and only has to wait for the other readers
+		if e.readers == 1 {
+			e.readers = 0
+			e.writer = true
+			close(e.upgrader.ready)
+			e.upgrader = nil
+		}
+		return
+	}
+	switch policy {
+	case FairnessWriterPreferring:
+		if e.waitingWriters == 0 {
+			e.grantReaders()
+		} else if e.readers == 0 {
+			e.handOver(e.firstWriter())
+		}
+	case FairnessReaderPreferring:
+		e.grantReaders()
+		if e.readers == 0 && e.waitingWriters > 0 {
+			e.handOver(e.firstWriter())
+		}
+	default:
+		for len(e.waiters) > 0 && !e.writer && (!e.waiters[0].write || e.readers == 0) {
+			e.handOver(0)
+		}
+	}
+}
 
-	if lock, ok := l.locks[key]; ok {
-		l.guard.Unlock()
-		return lock
+// grantReaders hands the lock over to all waiting readers.
+func (e *lockEntry) grantReaders() {
+	for i := 0; i < len(e.waiters); {
+		if e.waiters[i].write {
+			i++
+			continue
+		}
+		e.handOver(i)
 	}
+}
+
+func (e *lockEntry) firstWriter() int {
+	for i, w := range e.waiters {
+		if w.write {
+			return i
+		}
+	}
+	return -1
+}
+
+// handOver removes the i-th waiter from the queue and gives it the lock.
+func (e *lockEntry) handOver(i int) {
+	w := e.remove(i)
+	if w.write {
+		e.writer = true
+	} else {
+		e.readers++
+	}
+	close(w.ready)
+}
+
+// enqueue appends a new waiter to the queue.
+func (e *lockEntry) enqueue(write bool) *waiter {
+	w := &waiter{write: write, ready: make(chan struct{})}
+	e.waiters = append(e.waiters, w)
+	if write {
+		e.waitingWriters++
+	}
+	return w
+}
+
+// cancel gives up waiting for the lock, releasing it again if it has been handed over to w in the
+// meantime.
+func (e *lockEntry) cancel(w *waiter, policy FairnessPolicy) {
+	if i := slices.Index(e.waiters, w); i >= 0 {
+		e.remove(i)
+	} else {
+		e.release(w.write)
+	}
+	// a cancelled writer may have been holding back the waiters queued behind it
+	e.grant(policy)
+}
+
+func (e *lockEntry) remove(i int) *waiter {
+	w := e.waiters[i]
+	if w.write {
+		e.waitingWriters--
+	}
+	if i == 0 {
+		e.waiters[0] = nil
+		e.waiters = e.waiters[1:]
+	} else {
+		e.waiters = slices.Delete(e.waiters, i, i+1)
+	}
+	return w
+}
+
+type keyLock[K comparable] struct {
+	policy FairnessPolicy
+	guard  sync.Mutex
+	locks  map[K]*lockEntry
+}
+
+// NewKeyLock returns a KeyLock for string keys.
+func NewKeyLock() KeyLock[string] {
+	return NewKeyLockOf[string]()
+}
 
-	lock := &sync.RWMutex{}
-	l.locks[key] = lock
+// NewKeyLockOf returns a KeyLock for keys of type K which grants each key to its waiters in FIFO
+// order.
+func NewKeyLockOf[K comparable]() KeyLock[K] {
+	return NewKeyLockWithPolicy[K](FairnessFIFO)
+}
+
+// NewKeyLockWithPolicy returns a KeyLock for keys of type K which grants each key to its waiters
+// according to the given policy.
+func NewKeyLockWithPolicy[K comparable](policy FairnessPolicy) KeyLock[K] {
+	return &keyLock[K]{
+		policy: policy,
+		guard:  sync.Mutex{},
+		locks:  map[K]*lockEntry{},
+	}
+}
+
+func (l *keyLock[K]) lock(ctx context.Context, key K, write bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.guard.Lock()
+	entry, ok := l.locks[key]
+	if !ok {
+		entry = &lockEntry{}
+		l.locks[key] = entry
+	}
+	if entry.tryAcquire(write, l.policy) {
+		l.guard.Unlock()
+		return nil
+	}
+	w := entry.enqueue(write)
 	l.guard.Unlock()
-	return lock
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	entry.cancel(w, l.policy)
+	if entry.idle() {
+		delete(l.locks, key)
+	}
+	return ctx.Err()
+}
+
+func (l *keyLock[K]) tryLock(key K, write bool) bool {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	entry, ok := l.locks[key]
+	if !ok {
+		entry = &lockEntry{}
+	}
+	if !entry.tryAcquire(write, l.policy) {
+		return false
+	}
+	l.locks[key] = entry
+	return true
+}
+
+func (l *keyLock[K]) unlock(key K, write bool) {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	entry, ok := l.locks[key]
+	if !ok {
+		entry = &lockEntry{}
+	}
+	entry.release(write)
+	entry.grant(l.policy)
+	if entry.idle() {
+		delete(l.locks, key)
+	}
+}
+
+func (l *keyLock[K]) Lock(key K) {
+	_ = l.lock(context.Background(), key, true)
+}
+
+func (l *keyLock[K]) Unlock(key K) {
+	l.unlock(key, true)
+}
+
+func (l *keyLock[K]) RLock(key K) {
+	_ = l.lock(context.Background(), key, false)
+}
+
+func (l *keyLock[K]) RUnlock(key K) {
+	l.unlock(key, false)
 }
 
-func (l *keyLock) Lock(key string) {
-	l.getLock(key).Lock()
+func (l *keyLock[K]) LockContext(ctx context.Context, key K) error {
+	return l.lock(ctx, key, true)
 }
 
-func (l *keyLock) Unlock(key string) {
-	l.getLock(key).Unlock()
+func (l *keyLock[K]) RLockContext(ctx context.Context, key K) error {
+	return l.lock(ctx, key, false)
 }
 
-func (l *keyLock) RLock(key string) {
-	l.getLock(key).RLock()
+func (l *keyLock[K]) TryLock(key K) bool {
+	return l.tryLock(key, true)
 }
 
-func (l *keyLock) RUnlock(key string) {
-	l.getLock(key).RUnlock()
+func (l *keyLock[K]) TryRLock(key K) bool {
+	return l.tryLock(key, false)
 }
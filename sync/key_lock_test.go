@@ -1,10 +1,14 @@
 package sync
 
 import (
+	"context"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLockLock(t *testing.T) {
@@ -107,3 +111,183 @@ func TestRLockRLock(t *testing.T) {
 	l.RUnlock("my-key")
 	l.RUnlock("my-key")
 }
+
+func TestUnlockRemovesKey(t *testing.T) {
+	l := NewKeyLock().(*keyLock[string])
+
+	l.Lock("my-key")
+	l.RLock("other-key")
+	assert.Len(t, l.locks, 2)
+
+	l.Unlock("my-key")
+	assert.Len(t, l.locks, 1)
+
+	l.RUnlock("other-key")
+	assert.Empty(t, l.locks)
+}
+
+func TestUnlockUnlockedKey(t *testing.T) {
+	l := NewKeyLock()
+
+	assert.Panics(t, func() {
+		l.Unlock("my-key")
+	})
+}
+
+func TestLockManyKeysBounded(t *testing.T) {
+	l := NewKeyLock().(*keyLock[string])
+
+	keys := 1 << 20
+	if testing.Short() {
+		keys = 1 << 14
+	}
+	workers := 16
+
+	wg := sync.WaitGroup{}
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < keys; i += workers {
+				key := strconv.Itoa(i)
+				if i%2 == 0 {
+					l.Lock(key)
+					l.Unlock(key)
+				} else {
+					l.RLock(key)
+					l.RUnlock(key)
+				}
+				// also contend on a shared key so entries are reused by waiters
+				if i%64 == 0 {
+					l.Lock("shared")
+					l.Unlock("shared")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, l.locks)
+}
+
+func waiters[K comparable](l KeyLock[K], key K) int {
+	kl := l.(*keyLock[K])
+	kl.guard.Lock()
+	defer kl.guard.Unlock()
+	if entry, ok := kl.locks[key]; ok {
+		return len(entry.waiters)
+	}
+	return 0
+}
+
+func TestTryLock(t *testing.T) {
+	l := NewKeyLock()
+
+	require.True(t, l.TryLock("my-key"))
+	assert.False(t, l.TryLock("my-key"))
+	assert.False(t, l.TryRLock("my-key"))
+	assert.True(t, l.TryLock("other-key"))
+
+	l.Unlock("my-key")
+
+	require.True(t, l.TryRLock("my-key"))
+	assert.True(t, l.TryRLock("my-key"))
+	assert.False(t, l.TryLock("my-key"))
+
+	l.RUnlock("my-key")
+	l.RUnlock("my-key")
+	l.Unlock("other-key")
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestLockContext(t *testing.T) {
+	l := NewKeyLock()
+
+	require.NoError(t, l.LockContext(context.Background(), "my-key"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := l.LockContext(ctx, "my-key")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	err = l.RLockContext(ctx, "my-key")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the cancelled waiters must not acquire the lock behind our back
+	l.Unlock("my-key")
+	assert.True(t, l.TryLock("my-key"))
+	l.Unlock("my-key")
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestLockContextCancelledWriterUnblocksReaders(t *testing.T) {
+	l := NewKeyLock()
+
+	l.RLock("my-key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	writerDone := make(chan error)
+	go func() {
+		writerDone <- l.LockContext(ctx, "my-key")
+	}()
+	require.Eventually(t, func() bool {
+		return waiters(l, "my-key") == 1
+	}, time.Second, time.Millisecond)
+
+	readerDone := make(chan error)
+	go func() {
+		readerDone <- l.RLockContext(context.Background(), "my-key")
+	}()
+
+	cancel()
+	require.ErrorIs(t, <-writerDone, context.Canceled)
+	require.NoError(t, <-readerDone)
+
+	l.RUnlock("my-key")
+	l.RUnlock("my-key")
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestLockContextCancelledManyWaiters(t *testing.T) {
+	l := NewKeyLock()
+
+	l.Lock("my-key")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	for i := range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				err = l.LockContext(ctx, "my-key")
+			} else {
+				err = l.RLockContext(ctx, "my-key")
+			}
+			assert.ErrorIs(t, err, context.Canceled)
+		}()
+	}
+	cancel()
+	wg.Wait()
+
+	l.Unlock("my-key")
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestLockStructKey(t *testing.T) {
+	type namespacedName struct {
+		Namespace string
+		Name      string
+	}
+	l := NewKeyLockOf[namespacedName]()
+
+	l.Lock(namespacedName{Namespace: "default", Name: "my-app"})
+	assert.False(t, l.TryLock(namespacedName{Namespace: "default", Name: "my-app"}))
+	assert.True(t, l.TryLock(namespacedName{Namespace: "other", Name: "my-app"}))
+
+	l.Unlock(namespacedName{Namespace: "default", Name: "my-app"})
+	l.Unlock(namespacedName{Namespace: "other", Name: "my-app"})
+	assert.Empty(t, l.(*keyLock[namespacedName]).locks)
+}
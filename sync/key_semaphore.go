@@ -0,0 +1,195 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// KeySemaphore is a set of weighted semaphores identified by keys of type K. It bounds the number of
+// concurrent operations per key, e.g. to allow at most N concurrent fetches of the same repository.
+// Every key is limited to the default limit unless a per-key limit has been set with SetLimit.
+type KeySemaphore[K comparable] struct {
+	guard        sync.Mutex
+	defaultLimit int64
+	limits       map[K]int64
+	entries      map[K]*semaphoreEntry
+}
+
+type semaphoreWaiter struct {
+	weight int64
+	ready  chan struct{}
+	// err is set before ready is closed if the weight can no longer be acquired
+	err error
+}
+
+// semaphoreEntry is the state of a single key. Like the entries of KeyLock, it is removed as soon as
+// the key is neither acquired nor waited for.
+type semaphoreEntry struct {
+	used    int64
+	waiters []*semaphoreWaiter
+}
+
+// NewKeySemaphore returns a KeySemaphore which allows a total weight of defaultLimit per key.
+func NewKeySemaphore[K comparable](defaultLimit int64) *KeySemaphore[K] {
+	return &KeySemaphore[K]{
+		defaultLimit: defaultLimit,
+		limits:       map[K]int64{},
+		entries:      map[K]*semaphoreEntry{},
+	}
+}
+
+// SetLimit overrides the limit of the given key. A limit of zero or less restores the default limit.
+// Waiters for a weight exceeding the new limit fail.
+func (s *KeySemaphore[K]) SetLimit(key K, limit int64) {
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	if limit <= 0 {
+		delete(s.limits, key)
+	} else {
+		s.limits[key] = limit
+	}
+	if entry, ok := s.entries[key]; ok {
+		s.grant(key, entry)
+	}
+}
+
+// Limit returns the limit of the given key.
+func (s *KeySemaphore[K]) Limit(key K) int64 {
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	return s.limit(key)
+}
+
+func (s *KeySemaphore[K]) limit(key K) int64 {
+	if limit, ok := s.limits[key]; ok {
+		return limit
+	}
+	return s.defaultLimit
+}
+
+// Acquire acquires the given weight for key, blocking until it is available or ctx is done. On
+// failure it returns the context's error and leaves the semaphore unchanged. Waiters are served in
+// FIFO order, so a large weight is not starved by a stream of smaller ones. Acquire fails if the
+// weight is not positive or exceeds the limit of the key, also if the limit is lowered while
+// waiting.
+func (s *KeySemaphore[K]) Acquire(ctx context.Context, key K, weight int64) error {
+	if weight <= 0 {
+		return fmt.Errorf("weight %d of key %v is not positive", weight, key)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.guard.Lock()
+	if limit := s.limit(key); weight > limit {
+		s.guard.Unlock()
+		return exceedsLimit(key, weight, limit)
+	}
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &semaphoreEntry{}
+		s.entries[key] = entry
+	}
+	if len(entry.waiters) == 0 && entry.used+weight <= s.limit(key) {
+		entry.used += weight
+		s.guard.Unlock()
+		return nil
+	}
+	w := &semaphoreWaiter{weight: weight, ready: make(chan struct{})}
+	entry.waiters = append(entry.waiters, w)
+	s.guard.Unlock()
+
+	select {
+	case <-w.ready:
+		return w.err
+	case <-ctx.Done():
+	}
+
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	if !entry.dequeue(w) && w.err == nil {
+		// the weight was acquired while the context got cancelled, give it back
+		entry.used -= weight
+	}
+	s.grant(key, entry)
+	return ctx.Err()
+}
+
+// TryAcquire acquires the given weight for key if it is immediately available and reports whether it
+// did. A weight which is not positive is never acquired.
+func (s *KeySemaphore[K]) TryAcquire(key K, weight int64) bool {
+	if weight <= 0 {
+		return false
+	}
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &semaphoreEntry{}
+	}
+	if len(entry.waiters) > 0 || entry.used+weight > s.limit(key) {
+		return false
+	}
+	entry.used += weight
+	s.entries[key] = entry
+	return true
+}
+
+// Release releases the given weight for key. It panics if the weight is not positive.
+func (s *KeySemaphore[K]) Release(key K, weight int64) {
+	if weight <= 0 {
+		panic("sync: KeySemaphore released a weight which is not positive")
+	}
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || entry.used < weight {
+		panic("sync: KeySemaphore released more than held")
+	}
+	entry.used -= weight
+	s.grant(key, entry)
+}
+
+// grant fails the waiters whose weight exceeds the limit, hands the available weight over to the
+// waiters at the head of the queue and removes the entry once it is idle.
+func (s *KeySemaphore[K]) grant(key K, entry *semaphoreEntry) {
+	limit := s.limit(key)
+	entry.waiters = slices.DeleteFunc(entry.waiters, func(w *semaphoreWaiter) bool {
+		if w.weight <= limit {
+			return false
+		}
+		w.err = exceedsLimit(key, w.weight, limit)
+		close(w.ready)
+		return true
+	})
+	for len(entry.waiters) > 0 {
+		w := entry.waiters[0]
+		if entry.used+w.weight > limit {
+			break
+		}
+		entry.used += w.weight
+		entry.waiters[0] = nil
+		entry.waiters = entry.waiters[1:]
+		close(w.ready)
+	}
+	if entry.used == 0 && len(entry.waiters) == 0 {
+		delete(s.entries, key)
+	}
+}
+
+func exceedsLimit[K comparable](key K, weight, limit int64) error {
+	return fmt.Errorf("weight %d exceeds limit %d of key %v", weight, limit, key)
+}
+
+// dequeue removes w from the queue and reports whether it was still waiting.
+func (e *semaphoreEntry) dequeue(w *semaphoreWaiter) bool {
+	for i := range e.waiters {
+		if e.waiters[i] == w {
+			e.waiters = append(e.waiters[:i], e.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
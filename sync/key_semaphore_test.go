@@ -0,0 +1,172 @@
+package sync
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySemaphoreLimit(t *testing.T) {
+	s := NewKeySemaphore[string](2)
+	s.SetLimit("big-repo", 3)
+
+	assert.Equal(t, int64(2), s.Limit("my-repo"))
+	assert.Equal(t, int64(3), s.Limit("big-repo"))
+
+	require.NoError(t, s.Acquire(context.Background(), "my-repo", 1))
+	require.NoError(t, s.Acquire(context.Background(), "my-repo", 1))
+	assert.False(t, s.TryAcquire("my-repo", 1))
+	assert.True(t, s.TryAcquire("big-repo", 3))
+	assert.True(t, s.TryAcquire("other-repo", 2))
+
+	s.Release("my-repo", 1)
+	assert.True(t, s.TryAcquire("my-repo", 1))
+
+	s.Release("my-repo", 2)
+	s.Release("big-repo", 3)
+	s.Release("other-repo", 2)
+	assert.Empty(t, s.entries)
+
+	s.SetLimit("big-repo", 0)
+	assert.Equal(t, int64(2), s.Limit("big-repo"))
+}
+
+func TestKeySemaphoreWeightExceedsLimit(t *testing.T) {
+	s := NewKeySemaphore[string](2)
+
+	err := s.Acquire(context.Background(), "my-repo", 3)
+	require.Error(t, err)
+	assert.Empty(t, s.entries)
+}
+
+func TestKeySemaphoreWeightNotPositive(t *testing.T) {
+	s := NewKeySemaphore[string](2)
+
+	require.Error(t, s.Acquire(context.Background(), "my-repo", 0))
+	require.Error(t, s.Acquire(context.Background(), "my-repo", -1))
+	assert.False(t, s.TryAcquire("my-repo", -1))
+	require.NoError(t, s.Acquire(context.Background(), "my-repo", 1))
+	assert.Panics(t, func() {
+		s.Release("my-repo", -1)
+	})
+	s.Release("my-repo", 1)
+	assert.Empty(t, s.entries)
+}
+
+func TestKeySemaphoreReleaseNotHeld(t *testing.T) {
+	s := NewKeySemaphore[string](2)
+
+	assert.Panics(t, func() {
+		s.Release("my-repo", 1)
+	})
+}
+
+func TestKeySemaphoreAcquireContext(t *testing.T) {
+	s := NewKeySemaphore[string](2)
+
+	require.NoError(t, s.Acquire(context.Background(), "my-repo", 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := s.Acquire(ctx, "my-repo", 2)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the cancelled waiter must no longer hold back smaller weights
+	assert.True(t, s.TryAcquire("my-repo", 1))
+
+	s.Release("my-repo", 2)
+	assert.Empty(t, s.entries)
+}
+
+func TestKeySemaphoreSetLimitWakesWaiters(t *testing.T) {
+	s := NewKeySemaphore[string](1)
+
+	require.NoError(t, s.Acquire(context.Background(), "my-repo", 1))
+
+	done := make(chan error)
+	go func() {
+		done <- s.Acquire(context.Background(), "my-repo", 1)
+	}()
+	require.Eventually(t, func() bool {
+		s.guard.Lock()
+		defer s.guard.Unlock()
+		return len(s.entries["my-repo"].waiters) == 1
+	}, time.Second, time.Millisecond)
+
+	s.SetLimit("my-repo", 2)
+	require.NoError(t, <-done)
+
+	s.Release("my-repo", 2)
+	assert.Empty(t, s.entries)
+}
+
+func TestKeySemaphoreSetLimitFailsWaiters(t *testing.T) {
+	s := NewKeySemaphore[string](3)
+
+	require.NoError(t, s.Acquire(context.Background(), "my-repo", 1))
+
+	big := make(chan error)
+	go func() {
+		big <- s.Acquire(context.Background(), "my-repo", 3)
+	}()
+	require.Eventually(t, func() bool {
+		s.guard.Lock()
+		defer s.guard.Unlock()
+		return len(s.entries["my-repo"].waiters) == 1
+	}, time.Second, time.Millisecond)
+	small := make(chan error)
+	go func() {
+		small <- s.Acquire(context.Background(), "my-repo", 1)
+	}()
+	require.Eventually(t, func() bool {
+		s.guard.Lock()
+		defer s.guard.Unlock()
+		return len(s.entries["my-repo"].waiters) == 2
+	}, time.Second, time.Millisecond)
+
+	// the waiter for 3 can never be served with a limit of 2 and must not hold back the one behind it
+	s.SetLimit("my-repo", 2)
+	require.EqualError(t, <-big, "weight 3 exceeds limit 2 of key my-repo")
+	require.NoError(t, <-small)
+
+	s.Release("my-repo", 2)
+	assert.Empty(t, s.entries)
+}
+
+func TestKeySemaphoreConcurrency(t *testing.T) {
+	s := NewKeySemaphore[string](3)
+
+	var running, maxRunning atomic.Int64
+	wg := sync.WaitGroup{}
+	for i := range 64 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := "repo-" + strconv.Itoa(i%2)
+			for range 100 {
+				assert.NoError(t, s.Acquire(context.Background(), key, 1))
+				if key == "repo-0" {
+					n := running.Add(1)
+					for {
+						m := maxRunning.Load()
+						if n <= m || maxRunning.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					running.Add(-1)
+				}
+				s.Release(key, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxRunning.Load(), int64(3))
+	assert.Empty(t, s.entries)
+}
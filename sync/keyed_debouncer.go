@@ -0,0 +1,96 @@
+package sync
+
+import (
+	"sync"
+	"time"
+
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+// KeyedDebouncer coalesces bursts of triggers for the same key into a single trailing call of a
+// function. The function is called for a key once no trigger for it has arrived for wait, but no
+// later than maxWait after the first trigger of the burst. Setting maxWait to wait turns the
+// debouncer into a throttler which calls the function at most once per wait. Keys are forgotten as
+// soon as the function has been called for them.
+type KeyedDebouncer[K comparable] struct {
+	clock   argotime.Clock
+	wait    time.Duration
+	maxWait time.Duration
+	fn      func(K)
+
+	guard   sync.Mutex
+	pending map[K]*debounced
+}
+
+// debounced is a burst of triggers for a key which has not been flushed yet.
+type debounced struct {
+	first time.Time
+	timer generationTimer
+}
+
+// NewKeyedDebouncer returns a KeyedDebouncer which calls fn for a key after its triggers have been
+// quiet for wait, or after maxWait at the latest. A maxWait of zero or less never forces a call.
+func NewKeyedDebouncer[K comparable](wait, maxWait time.Duration, fn func(K)) *KeyedDebouncer[K] {
+	return NewKeyedDebouncerWithClock(argotime.RealClock{}, wait, maxWait, fn)
+}
+
+// NewKeyedDebouncerWithClock is like NewKeyedDebouncer but schedules calls with the given clock.
+func NewKeyedDebouncerWithClock[K comparable](clk argotime.Clock, wait, maxWait time.Duration, fn func(K)) *KeyedDebouncer[K] {
+	return &KeyedDebouncer[K]{
+		clock:   clk,
+		wait:    wait,
+		maxWait: maxWait,
+		fn:      fn,
+		pending: map[K]*debounced{},
+	}
+}
+
+// Trigger schedules a call of the function for key, postponing an already scheduled one.
+func (d *KeyedDebouncer[K]) Trigger(key K) {
+	now := d.clock.Now()
+	d.guard.Lock()
+	defer d.guard.Unlock()
+	p, ok := d.pending[key]
+	if !ok {
+		p = &debounced{first: now}
+		d.pending[key] = p
+	}
+	delay := d.wait
+	if d.maxWait > 0 {
+		delay = min(delay, p.first.Add(d.maxWait).Sub(now))
+	}
+	p.timer.schedule(d.clock, delay, func(generation uint64) {
+		d.fire(key, p, generation)
+	})
+}
+
+// Cancel drops the scheduled call for key, if any.
+func (d *KeyedDebouncer[K]) Cancel(key K) {
+	d.guard.Lock()
+	defer d.guard.Unlock()
+	if p, ok := d.pending[key]; ok {
+		p.timer.stop()
+		delete(d.pending, key)
+	}
+}
+
+// Stop drops all scheduled calls.
+func (d *KeyedDebouncer[K]) Stop() {
+	d.guard.Lock()
+	defer d.guard.Unlock()
+	for key, p := range d.pending {
+		p.timer.stop()
+		delete(d.pending, key)
+	}
+}
+
+func (d *KeyedDebouncer[K]) fire(key K, p *debounced, generation uint64) {
+	d.guard.Lock()
+	if d.pending[key] != p || !p.timer.current(generation) {
+		d.guard.Unlock()
+		return
+	}
+	delete(d.pending, key)
+	d.guard.Unlock()
+	d.fn(key)
+}
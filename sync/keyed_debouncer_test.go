@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+func newTestDebouncer(wait, maxWait time.Duration) (*KeyedDebouncer[string], *argotime.FakeClock, chan string) {
+	clock := argotime.NewFakeClock(time.Now())
+	calls := make(chan string, 10)
+	d := NewKeyedDebouncerWithClock(clock, wait, maxWait, func(key string) {
+		calls <- key
+	})
+	return d, clock, calls
+}
+
+func assertNoCall(t *testing.T, calls chan string) {
+	t.Helper()
+	select {
+	case key := <-calls:
+		t.Fatalf("unexpected call for %s", key)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestKeyedDebouncerTrailing(t *testing.T) {
+	d, clock, calls := newTestDebouncer(time.Second, 0)
+
+	d.Trigger("my-app")
+	clock.Step(900 * time.Millisecond)
+	d.Trigger("my-app")
+	clock.Step(900 * time.Millisecond)
+	d.Trigger("my-app")
+	d.Trigger("other-app")
+	clock.Step(900 * time.Millisecond)
+	assertNoCall(t, calls)
+
+	clock.Step(100 * time.Millisecond)
+	got := []string{<-calls, <-calls}
+	assert.ElementsMatch(t, []string{"my-app", "other-app"}, got)
+	assertNoCall(t, calls)
+
+	require.Eventually(t, func() bool {
+		d.guard.Lock()
+		defer d.guard.Unlock()
+		return len(d.pending) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestKeyedDebouncerMaxWait(t *testing.T) {
+	d, clock, calls := newTestDebouncer(time.Second, 2*time.Second)
+
+	// a steady stream of triggers is flushed every maxWait
+	for range 4 {
+		d.Trigger("my-app")
+		clock.Step(500 * time.Millisecond)
+	}
+	assert.Equal(t, "my-app", <-calls)
+	d.Trigger("my-app")
+	clock.Step(999 * time.Millisecond)
+	assertNoCall(t, calls)
+	clock.Step(time.Millisecond)
+	assert.Equal(t, "my-app", <-calls)
+}
+
+func TestKeyedDebouncerThrottle(t *testing.T) {
+	d, clock, calls := newTestDebouncer(3*time.Second, 3*time.Second)
+
+	d.Trigger("my-app")
+	clock.Step(time.Second)
+	d.Trigger("my-app")
+	clock.Step(time.Second)
+	d.Trigger("my-app")
+	clock.Step(time.Second)
+	assert.Equal(t, "my-app", <-calls)
+	assertNoCall(t, calls)
+}
+
+func TestKeyedDebouncerCancel(t *testing.T) {
+	d, clock, calls := newTestDebouncer(time.Second, 0)
+
+	d.Trigger("my-app")
+	d.Trigger("other-app")
+	d.Trigger("third-app")
+	d.Cancel("my-app")
+	clock.Step(time.Second)
+	assert.ElementsMatch(t, []string{"other-app", "third-app"}, []string{<-calls, <-calls})
+
+	d.Trigger("my-app")
+	d.Stop()
+	clock.Step(time.Second)
+	assertNoCall(t, calls)
+	assert.Empty(t, d.pending)
+}
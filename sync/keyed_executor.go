@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrExecutorShutdown is returned when submitting to a KeyedExecutor which has been shut down.
+var ErrExecutorShutdown = errors.New("keyed executor is shut down")
+
+// KeyedExecutor runs functions on a bounded pool of workers, sequentially and in submission order
+// per key and in parallel across keys. Unlike serializing with KeyLock, functions waiting for their
+// turn do not tie up a goroutine each.
+//
+// A panic in a submitted function is recovered and only logged, so it neither crashes the worker nor
+// holds up the functions queued after it. Unlike KeyedGroup, which re-panics in the caller, there is
+// no caller to hand the panic to, so functions have to report failures themselves.
+type KeyedExecutor[K comparable] struct {
+	guard sync.Mutex
+	cond  *sync.Cond
+	// queues holds the pending functions per key, the first of which may be running
+	queues map[K][]func()
+	// ready holds the keys with pending functions which are not running
+	ready []K
+	// pending is the number of submitted functions which have not completed yet
+	pending int
+	closed  bool
+	drained chan struct{}
+	once    sync.Once
+}
+
+// NewKeyedExecutor returns a KeyedExecutor which runs functions on the given number of workers.
+func NewKeyedExecutor[K comparable](workers int) *KeyedExecutor[K] {
+	if workers <= 0 {
+		panic("sync: NewKeyedExecutor requires a positive number of workers")
+	}
+	e := &KeyedExecutor[K]{
+		queues:  map[K][]func(){},
+		drained: make(chan struct{}),
+	}
+	e.cond = sync.NewCond(&e.guard)
+	for range workers {
+		go e.work()
+	}
+	return e
+}
+
+// Submit queues fn to run after all functions previously submitted for the same key have completed.
+// It returns ErrExecutorShutdown once Shutdown has been called.
+func (e *KeyedExecutor[K]) Submit(key K, fn func()) error {
+	e.guard.Lock()
+	defer e.guard.Unlock()
+	if e.closed {
+		return ErrExecutorShutdown
+	}
+	queue, ok := e.queues[key]
+	e.queues[key] = append(queue, fn)
+	e.pending++
+	if !ok {
+		e.ready = append(e.ready, key)
+		e.cond.Signal()
+	}
+	return nil
+}
+
+// Shutdown stops accepting new functions and waits until all submitted functions have completed,
+// or ctx is done, in which case it returns the context's error while the workers keep draining the
+// queues in the background.
+func (e *KeyedExecutor[K]) Shutdown(ctx context.Context) error {
+	e.guard.Lock()
+	e.closed = true
+	e.checkDrained()
+	e.cond.Broadcast()
+	e.guard.Unlock()
+
+	select {
+	case <-e.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *KeyedExecutor[K]) work() {
+	e.guard.Lock()
+	defer e.guard.Unlock()
+	for {
+		for len(e.ready) == 0 && !(e.closed && e.pending == 0) {
+			e.cond.Wait()
+		}
+		if len(e.ready) == 0 {
+			return
+		}
+		key := e.ready[0]
+		var zero K
+		e.ready[0] = zero
+		e.ready = e.ready[1:]
+		fn := e.queues[key][0]
+
+		e.guard.Unlock()
+		runKeyed(key, fn)
+		e.guard.Lock()
+
+		queue := e.queues[key]
+		queue[0] = nil
+		if queue = queue[1:]; len(queue) == 0 {
+			delete(e.queues, key)
+		} else {
+			// requeue at the back, so busy keys do not starve the others
+			e.queues[key] = queue
+			e.ready = append(e.ready, key)
+			e.cond.Signal()
+		}
+		e.pending--
+		e.checkDrained()
+	}
+}
+
+// checkDrained wakes up the shutdown once all functions have completed.
+func (e *KeyedExecutor[K]) checkDrained() {
+	if e.closed && e.pending == 0 {
+		e.once.Do(func() {
+			close(e.drained)
+		})
+		e.cond.Broadcast()
+	}
+}
+
+func runKeyed[K comparable](key K, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("recovered from panic while executing function for key %v: %v\n%s", key, r, debug.Stack())
+		}
+	}()
+	fn()
+}
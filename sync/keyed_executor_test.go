@@ -0,0 +1,119 @@
+package sync
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedExecutorOrderPerKey(t *testing.T) {
+	e := NewKeyedExecutor[string](4)
+
+	var mu sync.Mutex
+	got := map[string][]int{}
+	var running sync.Map
+	for i := range 100 {
+		for _, key := range []string{"a", "b", "c"} {
+			require.NoError(t, e.Submit(key, func() {
+				_, loaded := running.LoadOrStore(key, true)
+				assert.False(t, loaded, "functions for key %s overlap", key)
+				mu.Lock()
+				got[key] = append(got[key], i)
+				mu.Unlock()
+				running.Delete(key)
+			}))
+		}
+	}
+	require.NoError(t, e.Shutdown(context.Background()))
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.Len(t, got[key], 100)
+		for i, v := range got[key] {
+			assert.Equal(t, i, v)
+		}
+	}
+	assert.Empty(t, e.queues)
+}
+
+func TestKeyedExecutorParallelAcrossKeys(t *testing.T) {
+	e := NewKeyedExecutor[string](3)
+
+	var started sync.WaitGroup
+	started.Add(3)
+	release := make(chan struct{})
+	for i := range 3 {
+		require.NoError(t, e.Submit(strconv.Itoa(i), func() {
+			started.Done()
+			<-release
+		}))
+	}
+	// all three functions run at the same time, otherwise this would block forever
+	started.Wait()
+	close(release)
+	require.NoError(t, e.Shutdown(context.Background()))
+}
+
+func TestKeyedExecutorBoundedWorkers(t *testing.T) {
+	e := NewKeyedExecutor[int](2)
+
+	var running, maxRunning atomic.Int32
+	for i := range 20 {
+		require.NoError(t, e.Submit(i, func() {
+			n := running.Add(1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			running.Add(-1)
+		}))
+	}
+	require.NoError(t, e.Shutdown(context.Background()))
+	assert.LessOrEqual(t, maxRunning.Load(), int32(2))
+}
+
+func TestKeyedExecutorShutdown(t *testing.T) {
+	e := NewKeyedExecutor[string](1)
+
+	release := make(chan struct{})
+	var completed atomic.Int32
+	require.NoError(t, e.Submit("my-key", func() {
+		<-release
+		completed.Add(1)
+	}))
+	require.NoError(t, e.Submit("my-key", func() {
+		completed.Add(1)
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, e.Shutdown(ctx), context.DeadlineExceeded)
+	require.ErrorIs(t, e.Submit("my-key", func() {}), ErrExecutorShutdown)
+
+	// the queued functions are still drained
+	close(release)
+	require.NoError(t, e.Shutdown(context.Background()))
+	assert.Equal(t, int32(2), completed.Load())
+}
+
+func TestKeyedExecutorPanic(t *testing.T) {
+	e := NewKeyedExecutor[string](1)
+
+	var completed atomic.Bool
+	require.NoError(t, e.Submit("my-key", func() {
+		panic("boom")
+	}))
+	require.NoError(t, e.Submit("my-key", func() {
+		completed.Store(true)
+	}))
+	require.NoError(t, e.Shutdown(context.Background()))
+	assert.True(t, completed.Load())
+}
@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// KeyedGroup collapses concurrent calls for the same key into a single execution whose result is
+// shared with all callers. Executions for the same key are serialized with a KeyLock, so a call which
+// starts after Forget never overlaps with the one still in flight. Successful results can optionally
+// be cached for a TTL, errors are never cached.
+type KeyedGroup[K comparable, V any] struct {
+	ttl   time.Duration
+	locks KeyLock[K]
+	guard sync.Mutex
+	calls map[K]*keyedCall[V]
+}
+
+// keyedCall is an in-flight or cached call. val and err must only be read after done is closed.
+type keyedCall[V any] struct {
+	done chan struct{}
+	val  V
+	err  error
+}
+
+// NewKeyedGroup returns a KeyedGroup which caches successful results for ttl. A ttl of zero or less
+// disables caching, so only concurrent calls share a result.
+func NewKeyedGroup[K comparable, V any](ttl time.Duration) *KeyedGroup[K, V] {
+	return &KeyedGroup[K, V]{
+		ttl:   ttl,
+		locks: NewKeyLockOf[K](),
+		calls: map[K]*keyedCall[V]{},
+	}
+}
+
+// Do executes fn for the given key unless a call for the key is already in flight or its result is
+// still cached, in which case it waits for and returns that result instead. shared reports whether
+// the result was obtained from another call.
+func (g *KeyedGroup[K, V]) Do(key K, fn func() (V, error)) (v V, shared bool, err error) {
+	g.guard.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.guard.Unlock()
+		<-c.done
+		return c.val, true, c.err
+	}
+	c := &keyedCall[V]{done: make(chan struct{})}
+	g.calls[key] = c
+	g.guard.Unlock()
+
+	g.run(key, c, fn)
+	return c.val, false, c.err
+}
+
+// Forget drops the in-flight call or cached result for the given key, so the next call to Do
+// executes its function again.
+func (g *KeyedGroup[K, V]) Forget(key K) {
+	g.guard.Lock()
+	defer g.guard.Unlock()
+	delete(g.calls, key)
+}
+
+func (g *KeyedGroup[K, V]) run(key K, c *keyedCall[V], fn func() (V, error)) {
+	g.locks.Lock(key)
+	defer g.locks.Unlock(key)
+
+	returned := false
+	defer func() {
+		if returned {
+			return
+		}
+		// fn panicked or called runtime.Goexit, release the waiters before unwinding further
+		r := recover()
+		c.err = fmt.Errorf("call for key %v did not return: %v", key, r)
+		g.finish(key, c)
+		if r != nil {
+			panic(r)
+		}
+	}()
+	c.val, c.err = fn()
+	returned = true
+	g.finish(key, c)
+}
+
+func (g *KeyedGroup[K, V]) finish(key K, c *keyedCall[V]) {
+	g.guard.Lock()
+	defer g.guard.Unlock()
+	close(c.done)
+	if g.calls[key] != c {
+		// forgotten while in flight
+		return
+	}
+	if c.err != nil || g.ttl <= 0 {
+		delete(g.calls, key)
+		return
+	}
+	time.AfterFunc(g.ttl, func() {
+		g.guard.Lock()
+		defer g.guard.Unlock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedGroupDo(t *testing.T) {
+	g := NewKeyedGroup[string, int](time.Minute)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var sharedCount atomic.Int32
+	wg := sync.WaitGroup{}
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, shared, err := g.Do("my-key", fn)
+			assert.NoError(t, err)
+			assert.Equal(t, 42, v)
+			if shared {
+				sharedCount.Add(1)
+			}
+		}()
+	}
+	require.Eventually(t, func() bool {
+		return calls.Load() == 1
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, int32(9), sharedCount.Load())
+}
+
+func TestKeyedGroupNoTTL(t *testing.T) {
+	g := NewKeyedGroup[string, int](0)
+
+	var calls atomic.Int32
+	fn := func() (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	v, shared, _ := g.Do("my-key", fn)
+	assert.Equal(t, 1, v)
+	assert.False(t, shared)
+	assert.Empty(t, g.calls)
+
+	v, shared, _ = g.Do("my-key", fn)
+	assert.Equal(t, 2, v)
+	assert.False(t, shared)
+}
+
+func TestKeyedGroupTTL(t *testing.T) {
+	g := NewKeyedGroup[string, int](50 * time.Millisecond)
+
+	var calls atomic.Int32
+	fn := func() (int, error) {
+		return int(calls.Add(1)), nil
+	}
+
+	v, shared, _ := g.Do("my-key", fn)
+	assert.Equal(t, 1, v)
+	assert.False(t, shared)
+	v, shared, _ = g.Do("my-key", fn)
+	assert.Equal(t, 1, v)
+	assert.True(t, shared)
+	v, _, _ = g.Do("other-key", fn)
+	assert.Equal(t, 2, v)
+
+	g.Forget("my-key")
+	v, _, _ = g.Do("my-key", fn)
+	assert.Equal(t, 3, v)
+
+	require.Eventually(t, func() bool {
+		g.guard.Lock()
+		defer g.guard.Unlock()
+		return len(g.calls) == 0
+	}, time.Second, time.Millisecond)
+	v, _, _ = g.Do("my-key", fn)
+	assert.Equal(t, 4, v)
+}
+
+func TestKeyedGroupErrorNotCached(t *testing.T) {
+	g := NewKeyedGroup[string, int](time.Minute)
+
+	_, _, err := g.Do("my-key", func() (int, error) {
+		return 0, errors.New("boom")
+	})
+	require.EqualError(t, err, "boom")
+
+	v, shared, err := g.Do("my-key", func() (int, error) {
+		return 1, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.False(t, shared)
+}
+
+func TestKeyedGroupPanic(t *testing.T) {
+	g := NewKeyedGroup[string, int](time.Minute)
+
+	assert.Panics(t, func() {
+		_, _, _ = g.Do("my-key", func() (int, error) {
+			panic("boom")
+		})
+	})
+	assert.Empty(t, g.calls)
+
+	v, _, err := g.Do("my-key", func() (int, error) {
+		return 1, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestKeyedGroupForgetSerializesExecutions(t *testing.T) {
+	g := NewKeyedGroup[string, int](0)
+
+	var running atomic.Int32
+	release := make(chan struct{})
+	fn := func() (int, error) {
+		assert.Equal(t, int32(1), running.Add(1))
+		<-release
+		running.Add(-1)
+		return 0, nil
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _, err := g.Do("my-key", fn)
+		assert.NoError(t, err)
+	}()
+	require.Eventually(t, func() bool {
+		return running.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	g.Forget("my-key")
+	go func() {
+		defer wg.Done()
+		_, shared, err := g.Do("my-key", fn)
+		assert.NoError(t, err)
+		assert.False(t, shared)
+	}()
+	close(release)
+	wg.Wait()
+}
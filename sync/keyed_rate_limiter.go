@@ -0,0 +1,123 @@
+package sync
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+// KeyedRateLimiter is a set of token bucket rate limiters identified by keys of type K, e.g. to allow
+// no more than one refresh per application every few seconds. Every key starts with a full bucket of
+// burst tokens, which refills at one token per interval. Keys whose bucket has refilled completely
+// are indistinguishable from new keys and are evicted, so memory is bounded by the recently used keys.
+type KeyedRateLimiter[K comparable] struct {
+	clock    argotime.Clock
+	interval time.Duration
+	burst    int
+
+	guard     sync.Mutex
+	buckets   map[K]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	// tokens may be negative when waiters have reserved tokens ahead of time
+	tokens float64
+	last   time.Time
+}
+
+// NewKeyedRateLimiter returns a KeyedRateLimiter which allows bursts of up to burst events per key
+// and one event per interval on average.
+func NewKeyedRateLimiter[K comparable](interval time.Duration, burst int) *KeyedRateLimiter[K] {
+	return NewKeyedRateLimiterWithClock[K](argotime.RealClock{}, interval, burst)
+}
+
+// NewKeyedRateLimiterWithClock is like NewKeyedRateLimiter but measures time with the given clock.
+func NewKeyedRateLimiterWithClock[K comparable](clk argotime.Clock, interval time.Duration, burst int) *KeyedRateLimiter[K] {
+	if interval <= 0 || burst <= 0 {
+		panic("sync: NewKeyedRateLimiter requires a positive interval and burst")
+	}
+	return &KeyedRateLimiter[K]{
+		clock:     clk,
+		interval:  interval,
+		burst:     burst,
+		buckets:   map[K]*tokenBucket{},
+		lastSweep: clk.Now(),
+	}
+}
+
+// Allow reports whether an event for key may happen now, consuming a token if so.
+func (l *KeyedRateLimiter[K]) Allow(key K) bool {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	b := l.bucket(key, l.clock.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Wait blocks until an event for key may happen, or ctx is done, in which case it returns the
+// context's error without consuming a token.
+func (l *KeyedRateLimiter[K]) Wait(ctx context.Context, key K) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.guard.Lock()
+	b := l.bucket(key, l.clock.Now())
+	b.tokens--
+	delay := time.Duration(-b.tokens * float64(l.interval))
+	l.guard.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := l.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+	}
+
+	// give back the reserved token
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	b = l.bucket(key, l.clock.Now())
+	b.tokens = min(b.tokens+1, float64(l.burst))
+	return ctx.Err()
+}
+
+// bucket returns the bucket of key refilled up to now, and evicts the buckets which have refilled
+// completely once per refill period.
+func (l *KeyedRateLimiter[K]) bucket(key K, now time.Time) *tokenBucket {
+	refill := l.interval * time.Duration(l.burst)
+	if now.Sub(l.lastSweep) >= refill {
+		for k, b := range l.buckets {
+			if b.refill(now, l.interval, l.burst) >= float64(l.burst) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.refill(now, l.interval, l.burst)
+	return b
+}
+
+func (b *tokenBucket) refill(now time.Time, interval time.Duration, burst int) float64 {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.tokens+float64(elapsed)/float64(interval), float64(burst))
+		b.last = now
+	}
+	return b.tokens
+}
@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+func TestKeyedRateLimiterAllow(t *testing.T) {
+	clock := argotime.NewFakeClock(time.Now())
+	l := NewKeyedRateLimiterWithClock[string](clock, 3*time.Second, 2)
+
+	assert.True(t, l.Allow("my-app"))
+	assert.True(t, l.Allow("my-app"))
+	assert.False(t, l.Allow("my-app"))
+	assert.True(t, l.Allow("other-app"))
+
+	clock.Step(2 * time.Second)
+	assert.False(t, l.Allow("my-app"))
+	clock.Step(time.Second)
+	assert.True(t, l.Allow("my-app"))
+	assert.False(t, l.Allow("my-app"))
+
+	// the bucket does not refill beyond the burst
+	clock.Step(time.Minute)
+	assert.True(t, l.Allow("my-app"))
+	assert.True(t, l.Allow("my-app"))
+	assert.False(t, l.Allow("my-app"))
+}
+
+func TestKeyedRateLimiterEviction(t *testing.T) {
+	clock := argotime.NewFakeClock(time.Now())
+	l := NewKeyedRateLimiterWithClock[string](clock, time.Second, 2)
+
+	assert.True(t, l.Allow("my-app"))
+	assert.True(t, l.Allow("other-app"))
+	assert.True(t, l.Allow("other-app"))
+	assert.Len(t, l.buckets, 2)
+
+	clock.Step(time.Second)
+	assert.True(t, l.Allow("third-app"))
+	// my-app has refilled but other-app has not
+	assert.Len(t, l.buckets, 3)
+
+	clock.Step(time.Second)
+	assert.True(t, l.Allow("third-app"))
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestKeyedRateLimiterWait(t *testing.T) {
+	clock := argotime.NewFakeClock(time.Now())
+	l := NewKeyedRateLimiterWithClock[string](clock, 3*time.Second, 1)
+
+	require.NoError(t, l.Wait(context.Background(), "my-app"))
+
+	done := make(chan error)
+	go func() {
+		done <- l.Wait(context.Background(), "my-app")
+	}()
+	require.Eventually(t, clock.HasWaiters, time.Second, time.Millisecond)
+	clock.Step(2 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("waited less than the interval")
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Step(time.Second)
+	require.NoError(t, <-done)
+	assert.False(t, l.Allow("my-app"))
+}
+
+func TestKeyedRateLimiterWaitContext(t *testing.T) {
+	clock := argotime.NewFakeClock(time.Now())
+	l := NewKeyedRateLimiterWithClock[string](clock, 3*time.Second, 1)
+
+	assert.True(t, l.Allow("my-app"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.Wait(ctx, "my-app"), context.DeadlineExceeded)
+
+	// the cancelled wait did not consume a token
+	clock.Step(3 * time.Second)
+	assert.True(t, l.Allow("my-app"))
+}
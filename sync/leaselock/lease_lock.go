@@ -0,0 +1,365 @@
+// Package leaselock provides a KeyLock which serializes work across processes by means of
+// coordination.k8s.io/v1 Leases.
+package leaselock
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationv1client "k8s.io/client-go/kubernetes/typed/coordination/v1"
+
+	argosync "github.com/argoproj/pkg/v2/sync"
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+// KeyAnnotation is the annotation of a lease holding the key it was created for, as the lease name
+// is derived from a hash of the key.
+const KeyAnnotation = "argoproj.io/key-lock-key"
+
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRetryPeriod   = time.Second
+	DefaultPrefix        = "key-lock-"
+)
+
+// Config configures a lease-backed KeyLock.
+type Config struct {
+	// Client is used to manage the leases, e.g. clientset.CoordinationV1().
+	Client coordinationv1client.LeasesGetter
+	// Namespace is the namespace the leases are created in.
+	Namespace string
+	// Identity uniquely identifies this process among all processes sharing the leases, e.g. the pod name.
+	Identity string
+	// Prefix is prepended to the names of the leases. Defaults to DefaultPrefix.
+	Prefix string
+	// LeaseDuration is the time after which a lease which has not been renewed can be taken over by
+	// another process. Defaults to DefaultLeaseDuration.
+	LeaseDuration time.Duration
+	// RenewPeriod is the interval at which held leases are renewed. Defaults to a third of LeaseDuration.
+	RenewPeriod time.Duration
+	// RetryPeriod is the interval at which acquisition of a lease held by another process is retried.
+	// Defaults to DefaultRetryPeriod.
+	RetryPeriod time.Duration
+	// Clock defaults to the real clock.
+	Clock argotime.Clock
+	// OnLost is called with the key of a lock whose lease has been lost while it was still locked,
+	// either because another process took it over or because renewing it failed for LeaseDuration.
+	// The lease is no longer renewed afterwards, but the key stays locked for this process until it
+	// is unlocked. Losses are only logged if OnLost is nil.
+	OnLost func(key string)
+}
+
+type keyLock struct {
+	config Config
+	// local serializes the goroutines of this process, which all share the same identity
+	local argosync.KeyLock[string]
+
+	guard sync.Mutex
+	held  map[string]*heldLease
+}
+
+// heldLease is a lease held by this process along with the goroutine renewing it.
+type heldLease struct {
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewKeyLock returns a KeyLock which holds a Lease for every locked key. A lock is held until it
+// is unlocked or, should this process stop renewing it, until the lease expires. Leases are
+// exclusive, so read locks are acquired exclusively as well.
+//
+// A lease can be lost while the key is locked, e.g. if this process cannot reach the API server for
+// longer than LeaseDuration, after which another process may lock the key as well. Callers must
+// handle Config.OnLost by abandoning the work protected by the lock.
+func NewKeyLock(config Config) (argosync.KeyLock[string], error) {
+	if config.Client == nil {
+		return nil, errors.New("lease lock client must not be nil")
+	}
+	if config.Namespace == "" {
+		return nil, errors.New("lease lock namespace must not be empty")
+	}
+	if config.Identity == "" {
+		return nil, errors.New("lease lock identity must not be empty")
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+	if config.LeaseDuration <= 0 {
+		config.LeaseDuration = DefaultLeaseDuration
+	}
+	if config.RenewPeriod <= 0 {
+		config.RenewPeriod = config.LeaseDuration / 3
+	}
+	if config.RenewPeriod >= config.LeaseDuration {
+		return nil, fmt.Errorf("lease lock renew period %s must be less than the lease duration %s", config.RenewPeriod, config.LeaseDuration)
+	}
+	if config.RetryPeriod <= 0 {
+		config.RetryPeriod = DefaultRetryPeriod
+	}
+	if config.Clock == nil {
+		config.Clock = argotime.RealClock{}
+	}
+	return &keyLock{
+		config: config,
+		local:  argosync.NewKeyLock(),
+		held:   map[string]*heldLease{},
+	}, nil
+}
+
+// LeaseName returns the name of the lease backing the given key.
+func LeaseName(prefix, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return prefix + hex.EncodeToString(sum[:])
+}
+
+func (l *keyLock) Lock(key string) {
+	_ = l.LockContext(context.Background(), key)
+}
+
+// Unlock stops renewing the lease of the given key and deletes it. It blocks on these API calls for
+// up to LeaseDuration, after which the lease is left to expire.
+func (l *keyLock) Unlock(key string) {
+	l.guard.Lock()
+	held, ok := l.held[key]
+	delete(l.held, key)
+	l.guard.Unlock()
+	if !ok {
+		panic(fmt.Sprintf("leaselock: Unlock of unlocked key %s", key))
+	}
+
+	held.stop()
+	<-held.done
+	if err := l.release(key); err != nil {
+		log.Warnf("failed to release lease for key %s, it will expire after %s: %v", key, l.config.LeaseDuration, err)
+	}
+	l.local.Unlock(key)
+}
+
+func (l *keyLock) RLock(key string) {
+	l.Lock(key)
+}
+
+func (l *keyLock) RUnlock(key string) {
+	l.Unlock(key)
+}
+
+func (l *keyLock) LockContext(ctx context.Context, key string) error {
+	if err := l.local.LockContext(ctx, key); err != nil {
+		return err
+	}
+	for {
+		acquired, err := l.tryAcquire(ctx, key)
+		if err != nil {
+			log.Warnf("failed to acquire lease for key %s: %v", key, err)
+		}
+		if acquired {
+			l.startRenewal(key)
+			return nil
+		}
+		select {
+		case <-l.config.Clock.After(l.config.RetryPeriod):
+		case <-ctx.Done():
+			l.local.Unlock(key)
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *keyLock) RLockContext(ctx context.Context, key string) error {
+	return l.LockContext(ctx, key)
+}
+
+// TryLock makes a single attempt to acquire the lease of the given key, which gives up after
+// RetryPeriod if the API server does not respond.
+func (l *keyLock) TryLock(key string) bool {
+	if !l.local.TryLock(key) {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), l.config.RetryPeriod)
+	defer cancel()
+	acquired, err := l.tryAcquire(ctx, key)
+	if err != nil {
+		log.Warnf("failed to acquire lease for key %s: %v", key, err)
+	}
+	if !acquired {
+		l.local.Unlock(key)
+		return false
+	}
+	l.startRenewal(key)
+	return true
+}
+
+func (l *keyLock) TryRLock(key string) bool {
+	return l.TryLock(key)
+}
+
+// tryAcquire makes a single attempt to create or take over the lease of the given key.
+func (l *keyLock) tryAcquire(ctx context.Context, key string) (bool, error) {
+	leases := l.config.Client.Leases(l.config.Namespace)
+	name := LeaseName(l.config.Prefix, key)
+	now := metav1.NewMicroTime(l.config.Clock.Now())
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   l.config.Namespace,
+				Annotations: map[string]string{KeyAnnotation: key},
+			},
+		}
+		l.setHolder(lease, now)
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if holder := lease.Spec.HolderIdentity; holder != nil && *holder != "" && *holder != l.config.Identity && !l.expired(lease) {
+		return false, nil
+	}
+	// the lease is free, expired, or left over by an earlier incarnation of this process
+	l.setHolder(lease, now)
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *keyLock) setHolder(lease *coordinationv1.Lease, now metav1.MicroTime) {
+	seconds := int32(l.config.LeaseDuration.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	lease.Spec.HolderIdentity = &l.config.Identity
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+}
+
+func (l *keyLock) expired(lease *coordinationv1.Lease) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return !l.config.Clock.Now().Before(expiry)
+}
+
+func (l *keyLock) startRenewal(key string) {
+	ctx, stop := context.WithCancel(context.Background())
+	held := &heldLease{stop: stop, done: make(chan struct{})}
+	l.guard.Lock()
+	l.held[key] = held
+	l.guard.Unlock()
+
+	go func() {
+		lost := l.renewUntilStopped(ctx, key)
+		// Unlock waits for done, so OnLost is free to unlock the key
+		close(held.done)
+		if lost {
+			if l.config.OnLost != nil {
+				l.config.OnLost(key)
+			} else {
+				log.Errorf("lost lease for key %s, another process may hold it", key)
+			}
+		}
+	}()
+}
+
+// renewUntilStopped renews the lease of the given key every RenewPeriod until ctx is done. It
+// reports whether it stopped because the lease has been lost.
+func (l *keyLock) renewUntilStopped(ctx context.Context, key string) bool {
+	ticker := l.config.Clock.NewTicker(l.config.RenewPeriod)
+	defer ticker.Stop()
+	renewed := l.config.Clock.Now()
+	for {
+		select {
+		case <-ticker.C():
+			now := l.config.Clock.Now()
+			err := l.renew(ctx, key)
+			if ctx.Err() != nil {
+				return false
+			}
+			switch {
+			case err == nil:
+				renewed = now
+			case errors.Is(err, errLeaseLost):
+				log.Warnf("failed to renew lease for key %s: %v", key, err)
+				return true
+			default:
+				log.Warnf("failed to renew lease for key %s: %v", key, err)
+				if l.config.Clock.Since(renewed) >= l.config.LeaseDuration {
+					return true
+				}
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+var errLeaseLost = errors.New("lease lost")
+
+func (l *keyLock) renew(ctx context.Context, key string) error {
+	leases := l.config.Client.Leases(l.config.Namespace)
+	lease, err := leases.Get(ctx, LeaseName(l.config.Prefix, key), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: lease has been deleted", errLeaseLost)
+	}
+	if err != nil {
+		return err
+	}
+	if holder := lease.Spec.HolderIdentity; holder == nil || *holder != l.config.Identity {
+		return fmt.Errorf("%w: lease has been taken over by %v", errLeaseLost, holderOf(lease))
+	}
+	now := metav1.NewMicroTime(l.config.Clock.Now())
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// release deletes the lease of the given key, unless it has been taken over in the meantime. It
+// gives up after LeaseDuration, when the lease expires anyway.
+func (l *keyLock) release(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), l.config.LeaseDuration)
+	defer cancel()
+	leases := l.config.Client.Leases(l.config.Namespace)
+	lease, err := leases.Get(ctx, LeaseName(l.config.Prefix, key), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if holder := lease.Spec.HolderIdentity; holder == nil || *holder != l.config.Identity {
+		return nil
+	}
+	err = leases.Delete(ctx, lease.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return nil
+	}
+	return err
+}
+
+func holderOf(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
@@ -0,0 +1,247 @@
+package leaselock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	argosync "github.com/argoproj/pkg/v2/sync"
+	argotime "github.com/argoproj/pkg/v2/time"
+)
+
+const namespace = "argocd"
+
+func newTestKeyLock(t *testing.T, client *fake.Clientset, clock *argotime.FakeClock, identity string) argosync.KeyLock[string] {
+	t.Helper()
+	return newTestKeyLockWithOnLost(t, client, clock, identity, nil)
+}
+
+func newTestKeyLockWithOnLost(t *testing.T, client *fake.Clientset, clock *argotime.FakeClock, identity string, onLost func(string)) argosync.KeyLock[string] {
+	t.Helper()
+	l, err := NewKeyLock(Config{
+		Client:        client.CoordinationV1(),
+		Namespace:     namespace,
+		Identity:      identity,
+		LeaseDuration: 15 * time.Second,
+		RenewPeriod:   5 * time.Second,
+		RetryPeriod:   time.Second,
+		Clock:         clock,
+		OnLost:        onLost,
+	})
+	require.NoError(t, err)
+	return l
+}
+
+func getLease(t *testing.T, client *fake.Clientset, key string) *coordinationv1.Lease {
+	t.Helper()
+	lease, err := client.CoordinationV1().Leases(namespace).Get(context.Background(), LeaseName(DefaultPrefix, key), metav1.GetOptions{})
+	require.NoError(t, err)
+	return lease
+}
+
+func TestNewKeyLockValidation(t *testing.T) {
+	client := fake.NewClientset()
+
+	_, err := NewKeyLock(Config{Namespace: namespace, Identity: "a"})
+	require.Error(t, err)
+	_, err = NewKeyLock(Config{Client: client.CoordinationV1(), Identity: "a"})
+	require.Error(t, err)
+	_, err = NewKeyLock(Config{Client: client.CoordinationV1(), Namespace: namespace})
+	require.Error(t, err)
+	_, err = NewKeyLock(Config{Client: client.CoordinationV1(), Namespace: namespace, Identity: "a", RenewPeriod: time.Minute})
+	require.Error(t, err)
+	_, err = NewKeyLock(Config{Client: client.CoordinationV1(), Namespace: namespace, Identity: "a"})
+	require.NoError(t, err)
+}
+
+func TestLeaseName(t *testing.T) {
+	name := LeaseName(DefaultPrefix, "argocd/My_App")
+	assert.Len(t, name, len(DefaultPrefix)+64)
+	assert.Regexp(t, `^[a-z0-9-]+$`, name)
+	assert.NotEqual(t, name, LeaseName(DefaultPrefix, "argocd/my_app"))
+}
+
+func TestLockUnlock(t *testing.T) {
+	client := fake.NewClientset()
+	clock := argotime.NewFakeClock(time.Now())
+	l := newTestKeyLock(t, client, clock, "replica-a")
+
+	l.Lock("my-app")
+	lease := getLease(t, client, "my-app")
+	assert.Equal(t, "replica-a", *lease.Spec.HolderIdentity)
+	assert.Equal(t, int32(15), *lease.Spec.LeaseDurationSeconds)
+	assert.Equal(t, "my-app", lease.Annotations[KeyAnnotation])
+
+	l.Unlock("my-app")
+	leases, err := client.CoordinationV1().Leases(namespace).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, leases.Items)
+
+	assert.Panics(t, func() {
+		l.Unlock("my-app")
+	})
+}
+
+func TestLockAcrossReplicas(t *testing.T) {
+	client := fake.NewClientset()
+	clock := argotime.NewFakeClock(time.Now())
+	a := newTestKeyLock(t, client, clock, "replica-a")
+	b := newTestKeyLock(t, client, clock, "replica-b")
+
+	require.True(t, a.TryLock("my-app"))
+	assert.False(t, b.TryLock("my-app"))
+	assert.False(t, b.TryRLock("my-app"))
+	assert.True(t, b.TryLock("other-app"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, b.LockContext(ctx, "my-app"), context.DeadlineExceeded)
+
+	done := make(chan error)
+	go func() {
+		done <- b.RLockContext(context.Background(), "my-app")
+	}()
+	a.Unlock("my-app")
+	// the waiting replica retries once the retry period has passed
+	require.Eventually(t, func() bool {
+		clock.Step(time.Second)
+		select {
+		case err := <-done:
+			return assert.NoError(t, err)
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, "replica-b", *getLease(t, client, "my-app").Spec.HolderIdentity)
+
+	b.RUnlock("my-app")
+	b.Unlock("other-app")
+}
+
+func TestLockLocalGoroutines(t *testing.T) {
+	client := fake.NewClientset()
+	clock := argotime.NewFakeClock(time.Now())
+	l := newTestKeyLock(t, client, clock, "replica-a")
+
+	l.Lock("my-app")
+	assert.False(t, l.TryLock("my-app"))
+	l.Unlock("my-app")
+	assert.True(t, l.TryLock("my-app"))
+	l.Unlock("my-app")
+}
+
+func TestLockExpiredLease(t *testing.T) {
+	client := fake.NewClientset()
+	clock := argotime.NewFakeClock(time.Now())
+	l := newTestKeyLock(t, client, clock, "replica-a")
+
+	// a lease left behind by a replica which stopped renewing it
+	holder := "replica-crashed"
+	seconds := int32(15)
+	renewTime := metav1.NewMicroTime(clock.Now())
+	_, err := client.CoordinationV1().Leases(namespace).Create(context.Background(), &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: LeaseName(DefaultPrefix, "my-app"), Namespace: namespace},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			RenewTime:            &renewTime,
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	assert.False(t, l.TryLock("my-app"))
+	clock.Step(14 * time.Second)
+	assert.False(t, l.TryLock("my-app"))
+	clock.Step(time.Second)
+	require.True(t, l.TryLock("my-app"))
+	assert.Equal(t, "replica-a", *getLease(t, client, "my-app").Spec.HolderIdentity)
+	l.Unlock("my-app")
+}
+
+func TestLockRenewal(t *testing.T) {
+	client := fake.NewClientset()
+	clock := argotime.NewFakeClock(time.Now())
+	a := newTestKeyLock(t, client, clock, "replica-a")
+	b := newTestKeyLock(t, client, clock, "replica-b")
+
+	a.Lock("my-app")
+	for range 4 {
+		require.Eventually(t, clock.HasWaiters, time.Second, time.Millisecond)
+		renewed := clock.Now().Add(5 * time.Second)
+		clock.Step(5 * time.Second)
+		require.Eventually(t, func() bool {
+			return getLease(t, client, "my-app").Spec.RenewTime.Time.Equal(metav1.NewMicroTime(renewed).Time)
+		}, time.Second, time.Millisecond)
+	}
+	// 20s after the lease was acquired it is still held thanks to the renewals
+	assert.False(t, b.TryLock("my-app"))
+
+	a.Unlock("my-app")
+	assert.True(t, b.TryLock("my-app"))
+	b.Unlock("my-app")
+}
+
+func TestLockLostToOtherHolder(t *testing.T) {
+	client := fake.NewClientset()
+	clock := argotime.NewFakeClock(time.Now())
+	lost := make(chan string, 1)
+	l := newTestKeyLockWithOnLost(t, client, clock, "replica-a", func(key string) {
+		lost <- key
+	})
+
+	l.Lock("my-app")
+	// another replica considered the lease expired and took it over
+	lease := getLease(t, client, "my-app")
+	holder := "replica-b"
+	lease.Spec.HolderIdentity = &holder
+	_, err := client.CoordinationV1().Leases(namespace).Update(context.Background(), lease, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.Eventually(t, clock.HasWaiters, time.Second, time.Millisecond)
+	clock.Step(5 * time.Second)
+	assert.Equal(t, "my-app", <-lost)
+
+	// the lease of the other replica is neither renewed nor deleted
+	clock.Step(5 * time.Second)
+	l.Unlock("my-app")
+	assert.Equal(t, "replica-b", *getLease(t, client, "my-app").Spec.HolderIdentity)
+	assert.Empty(t, lost)
+}
+
+func TestLockLostToFailingRenewals(t *testing.T) {
+	client := fake.NewClientset()
+	clock := argotime.NewFakeClock(time.Now())
+	lost := make(chan string, 1)
+	l := newTestKeyLockWithOnLost(t, client, clock, "replica-a", func(key string) {
+		lost <- key
+	})
+
+	l.Lock("my-app")
+	client.PrependReactor("get", "leases", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+
+	// the lease is only lost once it has not been renewed for the lease duration
+	for range 2 {
+		require.Eventually(t, clock.HasWaiters, time.Second, time.Millisecond)
+		clock.Step(5 * time.Second)
+	}
+	select {
+	case key := <-lost:
+		t.Fatalf("lease of %s lost before it expired", key)
+	case <-time.After(10 * time.Millisecond):
+	}
+	clock.Step(5 * time.Second)
+	assert.Equal(t, "my-app", <-lost)
+
+	l.Unlock("my-app")
+}
@@ -0,0 +1,225 @@
+package sync
+
+import (
+	"cmp"
+	"context"
+	"reflect"
+	"slices"
+	"sync"
+)
+
+// LockAll acquires the write locks for all the given keys. Keys are deduplicated and acquired in a
+// canonical order, so concurrent callers locking overlapping sets of keys cannot deadlock each other.
+// The locks have to be released with UnlockAll and the same keys rather than one by one, as keys
+// without a natural order are tracked until then.
+func LockAll[K comparable](l KeyLock[K], keys ...K) {
+	_ = lockAll(context.Background(), l, keys, true)
+}
+
+// RLockAll acquires read locks for all the given keys in the same order as LockAll.
+func RLockAll[K comparable](l KeyLock[K], keys ...K) {
+	_ = lockAll(context.Background(), l, keys, false)
+}
+
+// LockAllContext acquires the write locks for all the given keys in the same order as LockAll. If
+// ctx is done before all locks are acquired, the locks acquired so far are released and the
+// context's error is returned.
+func LockAllContext[K comparable](ctx context.Context, l KeyLock[K], keys ...K) error {
+	return lockAll(ctx, l, keys, true)
+}
+
+// RLockAllContext acquires read locks for all the given keys in the same order as LockAll. If ctx is
+// done before all locks are acquired, the locks acquired so far are released and the context's error
+// is returned.
+func RLockAllContext[K comparable](ctx context.Context, l KeyLock[K], keys ...K) error {
+	return lockAll(ctx, l, keys, false)
+}
+
+// UnlockAll releases the write locks acquired by LockAll or LockAllContext. It has to be passed the
+// same keys.
+func UnlockAll[K comparable](l KeyLock[K], keys ...K) {
+	unlockAll(l, keys, true)
+}
+
+// RUnlockAll releases the read locks acquired by RLockAll or RLockAllContext. It has to be passed
+// the same keys.
+func RUnlockAll[K comparable](l KeyLock[K], keys ...K) {
+	unlockAll(l, keys, false)
+}
+
+// keyOrderer is implemented by KeyLocks on which distinct keys may share the same lock. It returns
+// one key per distinct lock, in the order they have to be acquired in.
+type keyOrderer[K comparable] interface {
+	lockOrder(keys []K) []K
+}
+
+func lockAll[K comparable](ctx context.Context, l KeyLock[K], keys []K, write bool) error {
+	ordered := acquireLockOrder(l, keys)
+	for i, key := range ordered {
+		var err error
+		if write {
+			err = l.LockContext(ctx, key)
+		} else {
+			err = l.RLockContext(ctx, key)
+		}
+		if err != nil {
+			release(l, ordered[:i], write)
+			releaseLockOrder(l, ordered)
+			return err
+		}
+	}
+	return nil
+}
+
+func unlockAll[K comparable](l KeyLock[K], keys []K, write bool) {
+	ordered := releaseLockOrder(l, keys)
+	release(l, ordered, write)
+}
+
+// release releases the given keys in the reverse order they were acquired in.
+func release[K comparable](l KeyLock[K], ordered []K, write bool) {
+	for _, key := range slices.Backward(ordered) {
+		if write {
+			l.Unlock(key)
+		} else {
+			l.RUnlock(key)
+		}
+	}
+}
+
+// acquireLockOrder returns the distinct keys in the order in which they have to be locked. Keys
+// whose underlying type is ordered are sorted by value, the order of other keys is registered until
+// releaseLockOrder is called, unless the KeyLock is a keyOrderer.
+func acquireLockOrder[K comparable](l KeyLock[K], keys []K) []K {
+	if o, ok := l.(keyOrderer[K]); ok {
+		return o.lockOrder(keys)
+	}
+	if compare := orderedCompare[K](); compare != nil {
+		ordered := distinct(keys)
+		slices.SortFunc(ordered, compare)
+		return ordered
+	}
+	return keyOrderOf[K]().acquire(keys)
+}
+
+// releaseLockOrder releases the order of keys registered by acquireLockOrder and returns the keys
+// to unlock.
+func releaseLockOrder[K comparable](l KeyLock[K], keys []K) []K {
+	if o, ok := l.(keyOrderer[K]); ok {
+		return o.lockOrder(keys)
+	}
+	if compare := orderedCompare[K](); compare != nil {
+		ordered := distinct(keys)
+		slices.SortFunc(ordered, compare)
+		return ordered
+	}
+	return keyOrderOf[K]().release(keys)
+}
+
+// orderedCompare returns a function comparing keys of type K by value if the underlying type of K
+// is ordered, and nil otherwise.
+func orderedCompare[K comparable]() func(a, b K) int {
+	switch reflect.TypeFor[K]().Kind() {
+	case reflect.String:
+		return func(a, b K) int {
+			return cmp.Compare(reflect.ValueOf(a).String(), reflect.ValueOf(b).String())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(a, b K) int {
+			return cmp.Compare(reflect.ValueOf(a).Int(), reflect.ValueOf(b).Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(a, b K) int {
+			return cmp.Compare(reflect.ValueOf(a).Uint(), reflect.ValueOf(b).Uint())
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(a, b K) int {
+			return cmp.Compare(reflect.ValueOf(a).Float(), reflect.ValueOf(b).Float())
+		}
+	}
+	return nil
+}
+
+// keyOrders holds the keyOrder of each key type.
+var keyOrders sync.Map
+
+// keyOrder is the canonical order in which keys of type K without a natural order, e.g. structs,
+// pointers or interfaces, are locked by LockAll. Keys are ordered
+// by a sequence number assigned when they are first passed to LockAll, which is kept as long as any
+// LockAll call for the key is in progress or holding it. As concurrent callers locking overlapping
+// sets of keys both see the sequence numbers of the keys they share, they lock them in the same
+// order. Unlike an order derived from a representation of the keys, this is a total order for any
+// comparable type, including pointers and interfaces holding values of different types.
+type keyOrder[K comparable] struct {
+	guard sync.Mutex
+	next  uint64
+	keys  map[K]*keySeq
+}
+
+type keySeq struct {
+	seq  uint64
+	refs int
+}
+
+func keyOrderOf[K comparable]() *keyOrder[K] {
+	o, _ := keyOrders.LoadOrStore(reflect.TypeFor[K](), &keyOrder[K]{keys: map[K]*keySeq{}})
+	return o.(*keyOrder[K])
+}
+
+// acquire registers the distinct keys and returns them sorted by their sequence number.
+func (o *keyOrder[K]) acquire(keys []K) []K {
+	ordered := distinct(keys)
+	o.guard.Lock()
+	defer o.guard.Unlock()
+	for _, key := range ordered {
+		s, ok := o.keys[key]
+		if !ok {
+			s = &keySeq{seq: o.next}
+			o.next++
+			o.keys[key] = s
+		}
+		s.refs++
+	}
+	slices.SortFunc(ordered, func(a, b K) int {
+		return cmp.Compare(o.keys[a].seq, o.keys[b].seq)
+	})
+	return ordered
+}
+
+// release unregisters the distinct keys and returns them in the order they were acquired in.
+func (o *keyOrder[K]) release(keys []K) []K {
+	ordered := distinct(keys)
+	o.guard.Lock()
+	defer o.guard.Unlock()
+	slices.SortFunc(ordered, func(a, b K) int {
+		return cmp.Compare(o.seq(a), o.seq(b))
+	})
+	for _, key := range ordered {
+		if s, ok := o.keys[key]; ok {
+			s.refs--
+			if s.refs == 0 {
+				delete(o.keys, key)
+			}
+		}
+	}
+	return ordered
+}
+
+func (o *keyOrder[K]) seq(key K) uint64 {
+	if s, ok := o.keys[key]; ok {
+		return s.seq
+	}
+	return 0
+}
+
+func distinct[K comparable](keys []K) []K {
+	seen := make(map[K]struct{}, len(keys))
+	ordered := make([]K, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			ordered = append(ordered, key)
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,166 @@
+package sync
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockOrder(t *testing.T) {
+	type key struct {
+		Namespace string
+		Name      string
+	}
+	o := keyOrderOf[key]()
+	first := o.acquire([]key{{"ns", "b"}, {"ns", "a"}, {"ns", "b"}})
+	assert.Equal(t, []key{{"ns", "b"}, {"ns", "a"}}, first)
+	assert.Equal(t, first, o.acquire([]key{{"ns", "a"}, {"ns", "b"}}))
+
+	assert.Equal(t, first, o.release([]key{{"ns", "a"}, {"ns", "b"}}))
+	assert.Len(t, o.keys, 2)
+	o.release(first)
+	assert.Empty(t, o.keys)
+}
+
+func TestLockOrderOrderedKeys(t *testing.T) {
+	l := NewKeyLock()
+	assert.Equal(t, []string{"a", "b", "c"}, acquireLockOrder(l, []string{"c", "a", "b", "a", "c"}))
+	assert.Empty(t, acquireLockOrder(l, []string{}))
+
+	type appName string
+	assert.Equal(t, []appName{"a", "b"}, acquireLockOrder(NewKeyLockOf[appName](), []appName{"b", "a"}))
+	assert.Equal(t, []int{-1, 2, 10}, acquireLockOrder(NewKeyLockOf[int](), []int{10, -1, 2}))
+	assert.Equal(t, []uint8{1, 2}, acquireLockOrder(NewKeyLockOf[uint8](), []uint8{2, 1}))
+	assert.Equal(t, []float64{-0.5, 1.5}, acquireLockOrder(NewKeyLockOf[float64](), []float64{1.5, -0.5}))
+}
+
+func TestLockAllUnlockOneByOne(t *testing.T) {
+	l := NewKeyLock()
+
+	// keys ordered by value are not tracked, so releasing them one by one leaks nothing
+	LockAll(l, "x", "y")
+	l.Unlock("x")
+	l.Unlock("y")
+	_, tracked := keyOrders.Load(reflect.TypeFor[string]())
+	assert.False(t, tracked)
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestLockOrderIndistinguishableKeys(t *testing.T) {
+	type value struct{ X int }
+	// distinct keys with the same representation must still be ordered consistently
+	a, b := &value{X: 1}, &value{X: 1}
+	pointers := keyOrderOf[*value]()
+	ordered := pointers.acquire([]*value{a, b})
+	assert.Same(t, a, ordered[0])
+	assert.Equal(t, ordered, pointers.acquire([]*value{b, a}))
+	pointers.release(ordered)
+	pointers.release(ordered)
+	assert.Empty(t, pointers.keys)
+
+	mixed := keyOrderOf[any]()
+	mixedOrdered := mixed.acquire([]any{int64(1), 1})
+	assert.Equal(t, []any{int64(1), 1}, mixedOrdered)
+	assert.Equal(t, mixedOrdered, mixed.acquire([]any{1, int64(1)}))
+	mixed.release(mixedOrdered)
+	mixed.release(mixedOrdered)
+	assert.Empty(t, mixed.keys)
+}
+
+func TestLockAllIndistinguishableKeysOppositeOrder(t *testing.T) {
+	type value struct{ X int }
+	pointers := NewKeyLockOf[*value]()
+	a, b := &value{X: 1}, &value{X: 1}
+	mixed := NewKeyLockOf[any]()
+
+	wg := sync.WaitGroup{}
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pointerKeys := []*value{a, b}
+			mixedKeys := []any{1, int64(1)}
+			if i%2 == 0 {
+				pointerKeys = []*value{b, a}
+				mixedKeys = []any{int64(1), 1}
+			}
+			for range 1000 {
+				LockAll(pointers, pointerKeys...)
+				UnlockAll(pointers, pointerKeys...)
+				LockAll(mixed, mixedKeys...)
+				UnlockAll(mixed, mixedKeys...)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, pointers.(*keyLock[*value]).locks)
+	assert.Empty(t, mixed.(*keyLock[any]).locks)
+	assert.Empty(t, keyOrderOf[any]().keys)
+}
+
+func TestLockAll(t *testing.T) {
+	l := NewKeyLock()
+
+	LockAll(l, "src", "dst", "src")
+	assert.False(t, l.TryRLock("src"))
+	assert.False(t, l.TryRLock("dst"))
+	UnlockAll(l, "src", "dst", "src")
+
+	RLockAll(l, "src", "dst")
+	assert.True(t, l.TryRLock("src"))
+	assert.False(t, l.TryLock("dst"))
+	l.RUnlock("src")
+	RUnlockAll(l, "dst", "src")
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestLockAllOppositeOrder(t *testing.T) {
+	l := NewKeyLock()
+
+	wg := sync.WaitGroup{}
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys := []string{"a", "b", "c"}
+			if i%2 == 0 {
+				keys = []string{"c", "b", "a"}
+			}
+			for range 1000 {
+				LockAll(l, keys...)
+				UnlockAll(l, keys...)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestLockAllContextPartialFailure(t *testing.T) {
+	l := NewKeyLock()
+
+	l.Lock("b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := LockAllContext(ctx, l, "c", "b", "a")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// "a" was acquired before blocking on "b" and must have been released again
+	assert.True(t, l.TryLock("a"))
+	l.Unlock("a")
+	l.Unlock("b")
+
+	require.NoError(t, RLockAllContext(context.Background(), l, "a", "b"))
+	RUnlockAll(l, "a", "b")
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrNotLockOwner is returned when releasing a key which is not held by the given token.
+var ErrNotLockOwner = errors.New("key is not locked by the given token")
+
+// LockToken identifies the owner of a key held by a ReentrantKeyLock.
+type LockToken uint64
+
+type lockTokenKey struct{}
+
+// WithLockToken returns a copy of ctx carrying the given token, which makes ReentrantKeyLock.Lock
+// calls with the returned context acquire keys on behalf of the token's owner.
+func WithLockToken(ctx context.Context, token LockToken) context.Context {
+	return context.WithValue(ctx, lockTokenKey{}, token)
+}
+
+// LockTokenFromContext returns the token carried by ctx, if any.
+func LockTokenFromContext(ctx context.Context) (LockToken, bool) {
+	token, ok := ctx.Value(lockTokenKey{}).(LockToken)
+	return token, ok
+}
+
+// reentrantOwner is the owner of a held key and the number of times it has acquired it.
+type reentrantOwner struct {
+	token LockToken
+	count int
+}
+
+// ReentrantKeyLock is an exclusive keyed lock which can be re-acquired by its owner. Ownership is
+// identified by a LockToken carried in the context, so a code path which re-enters a section
+// already holding the key for the same owner does not deadlock.
+type ReentrantKeyLock[K comparable] struct {
+	locks     KeyLock[K]
+	nextToken atomic.Uint64
+
+	guard  sync.Mutex
+	owners map[K]*reentrantOwner
+}
+
+// NewReentrantKeyLock returns a ReentrantKeyLock for keys of type K.
+func NewReentrantKeyLock[K comparable]() *ReentrantKeyLock[K] {
+	return &ReentrantKeyLock[K]{
+		locks:  NewKeyLockOf[K](),
+		owners: map[K]*reentrantOwner{},
+	}
+}
+
+// Lock acquires key on behalf of the token carried by ctx, or of a new token if ctx carries none,
+// and returns that token. If the token already holds the key, the acquisition is counted instead of
+// blocking. Otherwise Lock blocks until the key is available or ctx is done, in which case the
+// context's error is returned. Every successful Lock must be matched by an Unlock with the token.
+//
+//	token, err := l.Lock(ctx, key)
+//	if err != nil {
+//		return err
+//	}
+//	defer l.Unlock(key, token)
+//	ctx = sync.WithLockToken(ctx, token)
+func (l *ReentrantKeyLock[K]) Lock(ctx context.Context, key K) (LockToken, error) {
+	token, ok := LockTokenFromContext(ctx)
+	if ok {
+		l.guard.Lock()
+		if owner, held := l.owners[key]; held && owner.token == token {
+			owner.count++
+			l.guard.Unlock()
+			return token, nil
+		}
+		l.guard.Unlock()
+	} else {
+		token = LockToken(l.nextToken.Add(1))
+	}
+
+	if err := l.locks.LockContext(ctx, key); err != nil {
+		return 0, err
+	}
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	l.owners[key] = &reentrantOwner{token: token, count: 1}
+	return token, nil
+}
+
+// Unlock releases one acquisition of key by token. The key becomes available to others once all
+// acquisitions of the token have been released. It returns ErrNotLockOwner if the key is not held
+// by token.
+func (l *ReentrantKeyLock[K]) Unlock(key K, token LockToken) error {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	owner, ok := l.owners[key]
+	if !ok || owner.token != token {
+		return ErrNotLockOwner
+	}
+	owner.count--
+	if owner.count == 0 {
+		delete(l.owners, key)
+		l.locks.Unlock(key)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReentrantKeyLock(t *testing.T) {
+	l := NewReentrantKeyLock[string]()
+
+	token, err := l.Lock(context.Background(), "my-app")
+	require.NoError(t, err)
+	ctx := WithLockToken(context.Background(), token)
+
+	// re-entering with the token in the context does not block
+	again, err := l.Lock(ctx, "my-app")
+	require.NoError(t, err)
+	assert.Equal(t, token, again)
+
+	// others block until all acquisitions have been released
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = l.Lock(timeout, "my-app")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, l.Unlock("my-app", token))
+	assert.False(t, l.locks.TryLock("my-app"))
+	require.NoError(t, l.Unlock("my-app", token))
+
+	other, err := l.Lock(context.Background(), "my-app")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+	require.NoError(t, l.Unlock("my-app", other))
+
+	assert.Empty(t, l.owners)
+}
+
+func TestReentrantKeyLockOtherKey(t *testing.T) {
+	l := NewReentrantKeyLock[string]()
+
+	token, err := l.Lock(context.Background(), "my-app")
+	require.NoError(t, err)
+	ctx := WithLockToken(context.Background(), token)
+
+	// the same token can acquire further keys, which are owned by it as well
+	again, err := l.Lock(ctx, "other-app")
+	require.NoError(t, err)
+	assert.Equal(t, token, again)
+
+	require.NoError(t, l.Unlock("other-app", token))
+	require.NoError(t, l.Unlock("my-app", token))
+}
+
+func TestReentrantKeyLockUnlockNotOwner(t *testing.T) {
+	l := NewReentrantKeyLock[string]()
+
+	require.ErrorIs(t, l.Unlock("my-app", 1), ErrNotLockOwner)
+
+	token, err := l.Lock(context.Background(), "my-app")
+	require.NoError(t, err)
+	require.ErrorIs(t, l.Unlock("my-app", token+1), ErrNotLockOwner)
+	require.NoError(t, l.Unlock("my-app", token))
+	require.ErrorIs(t, l.Unlock("my-app", token), ErrNotLockOwner)
+}
+
+func TestLockTokenFromContext(t *testing.T) {
+	_, ok := LockTokenFromContext(context.Background())
+	assert.False(t, ok)
+
+	token, ok := LockTokenFromContext(WithLockToken(context.Background(), 42))
+	assert.True(t, ok)
+	assert.Equal(t, LockToken(42), token)
+}
@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"hash/maphash"
+	"slices"
+	"sync"
+)
+
+// stripe is one of the fixed set of locks of a stripedKeyLock.
+type stripe struct {
+	guard sync.Mutex
+	entry lockEntry
+}
+
+type stripedKeyLock[K comparable] struct {
+	seed    maphash.Seed
+	stripes []stripe
+}
+
+// NewStripedKeyLock returns a KeyLock which hashes keys onto a fixed set of n locks. Unlike the
+// KeyLock returned by NewKeyLockOf it does not allocate per key, at the cost of distinct keys
+// occasionally sharing a lock and therefore blocking each other.
+func NewStripedKeyLock[K comparable](n int) KeyLock[K] {
+	if n <= 0 {
+		panic("sync: NewStripedKeyLock requires a positive number of stripes")
+	}
+	return &stripedKeyLock[K]{
+		seed:    maphash.MakeSeed(),
+		stripes: make([]stripe, n),
+	}
+}
+
+func (l *stripedKeyLock[K]) index(key K) int {
+	return int(maphash.Comparable(l.seed, key) % uint64(len(l.stripes)))
+}
+
+func (l *stripedKeyLock[K]) stripe(key K) *stripe {
+	return &l.stripes[l.index(key)]
+}
+
+func (s *stripe) lock(ctx context.Context, write bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.guard.Lock()
+	if s.entry.tryAcquire(write, FairnessFIFO) {
+		s.guard.Unlock()
+		return nil
+	}
+	w := s.entry.enqueue(write)
+	s.guard.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	s.entry.cancel(w, FairnessFIFO)
+	return ctx.Err()
+}
+
+func (s *stripe) tryLock(write bool) bool {
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	return s.entry.tryAcquire(write, FairnessFIFO)
+}
+
+func (s *stripe) unlock(write bool) {
+	s.guard.Lock()
+	defer s.guard.Unlock()
+	s.entry.release(write)
+	s.entry.grant(FairnessFIFO)
+}
+
+func (l *stripedKeyLock[K]) Lock(key K) {
+	_ = l.stripe(key).lock(context.Background(), true)
+}
+
+func (l *stripedKeyLock[K]) Unlock(key K) {
+	l.stripe(key).unlock(true)
+}
+
+func (l *stripedKeyLock[K]) RLock(key K) {
+	_ = l.stripe(key).lock(context.Background(), false)
+}
+
+func (l *stripedKeyLock[K]) RUnlock(key K) {
+	l.stripe(key).unlock(false)
+}
+
+func (l *stripedKeyLock[K]) LockContext(ctx context.Context, key K) error {
+	return l.stripe(key).lock(ctx, true)
+}
+
+func (l *stripedKeyLock[K]) RLockContext(ctx context.Context, key K) error {
+	return l.stripe(key).lock(ctx, false)
+}
+
+func (l *stripedKeyLock[K]) TryLock(key K) bool {
+	return l.stripe(key).tryLock(true)
+}
+
+func (l *stripedKeyLock[K]) TryRLock(key K) bool {
+	return l.stripe(key).tryLock(false)
+}
+
+// lockOrder returns one key per stripe ordered by stripe, as keys sharing a stripe must only be
+// locked once.
+func (l *stripedKeyLock[K]) lockOrder(keys []K) []K {
+	type indexedKey struct {
+		index int
+		key   K
+	}
+	indexed := make([]indexedKey, 0, len(keys))
+	for _, key := range keys {
+		indexed = append(indexed, indexedKey{index: l.index(key), key: key})
+	}
+	slices.SortStableFunc(indexed, func(a, b indexedKey) int {
+		return a.index - b.index
+	})
+	indexed = slices.CompactFunc(indexed, func(a, b indexedKey) bool {
+		return a.index == b.index
+	})
+	ordered := make([]K, 0, len(indexed))
+	for _, k := range indexed {
+		ordered = append(ordered, k.key)
+	}
+	return ordered
+}
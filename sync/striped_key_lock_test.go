@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripedKeyLock(t *testing.T) {
+	l := NewStripedKeyLock[string](1)
+
+	l.Lock("my-key")
+	assert.False(t, l.TryRLock("my-key"))
+	// with a single stripe all keys share the same lock
+	assert.False(t, l.TryLock("other-key"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.RLockContext(ctx, "my-key"), context.DeadlineExceeded)
+
+	l.Unlock("my-key")
+	require.True(t, l.TryRLock("my-key"))
+	require.NoError(t, l.RLockContext(context.Background(), "other-key"))
+	assert.False(t, l.TryLock("my-key"))
+	l.RUnlock("my-key")
+	l.RUnlock("other-key")
+
+	assert.Panics(t, func() {
+		l.Unlock("my-key")
+	})
+}
+
+func TestStripedKeyLockExclusion(t *testing.T) {
+	l := NewStripedKeyLock[int](16)
+
+	counters := make([]int, 64)
+	wg := sync.WaitGroup{}
+	for i := range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 1000 {
+				key := (i + j) % len(counters)
+				l.Lock(key)
+				counters[key]++
+				l.Unlock(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, c := range counters {
+		total += c
+	}
+	assert.Equal(t, 32*1000, total)
+}
+
+func TestStripedKeyLockLockAll(t *testing.T) {
+	l := NewStripedKeyLock[int](4)
+
+	keys := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	// more keys than stripes, so some keys necessarily share a stripe
+	stripes := map[int]bool{}
+	for _, key := range keys {
+		stripes[l.(*stripedKeyLock[int]).index(key)] = true
+	}
+	assert.Len(t, l.(*stripedKeyLock[int]).lockOrder(keys), len(stripes))
+
+	LockAll(l, keys...)
+	for _, key := range keys {
+		assert.False(t, l.TryRLock(key))
+	}
+	UnlockAll(l, keys...)
+	for _, key := range keys {
+		assert.True(t, l.TryLock(key))
+		l.Unlock(key)
+	}
+}
+
+var benchmarkKeyLocks = []struct {
+	name       string
+	newKeyLock func() KeyLock[string]
+}{
+	{"Map", NewKeyLock},
+	{"Striped", func() KeyLock[string] { return NewStripedKeyLock[string](256) }},
+}
+
+// BenchmarkKeyLockHighContention locks a small set of hot keys from many goroutines.
+func BenchmarkKeyLockHighContention(b *testing.B) {
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = "app-" + strconv.Itoa(i)
+	}
+	for _, bm := range benchmarkKeyLocks {
+		b.Run(bm.name, func(b *testing.B) {
+			l := bm.newKeyLock()
+			var n atomic.Uint64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := keys[n.Add(1)%uint64(len(keys))]
+					l.Lock(key)
+					l.Unlock(key)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkKeyLockHighChurn locks a distinct key on every iteration.
+func BenchmarkKeyLockHighChurn(b *testing.B) {
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = "pod-" + strconv.Itoa(i)
+	}
+	for _, bm := range benchmarkKeyLocks {
+		b.Run(bm.name, func(b *testing.B) {
+			l := bm.newKeyLock()
+			var n atomic.Uint64
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					key := keys[n.Add(1)%uint64(len(keys))]
+					l.Lock(key)
+					l.Unlock(key)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package synctest
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	argosync "github.com/argoproj/pkg/v2/sync"
+)
+
+// Acquisition is a pending attempt to acquire a FakeKeyLock, which blocks until the test calls
+// Grant or Fail.
+type Acquisition[K comparable] struct {
+	Key   K
+	Write bool
+
+	result   chan error
+	resolved atomic.Bool
+}
+
+// Grant lets the acquisition succeed.
+func (a *Acquisition[K]) Grant() {
+	a.Fail(nil)
+}
+
+// Fail lets the acquisition fail with err. LockContext and RLockContext return err, while Lock and
+// RLock, which cannot report an error, panic with it.
+func (a *Acquisition[K]) Fail(err error) {
+	if a.resolved.Swap(true) {
+		panic(fmt.Sprintf("synctest: acquisition of key %v resolved twice", a.Key))
+	}
+	a.result <- err
+}
+
+// FakeKeyLock is a KeyLock whose acquisitions are decided by the test instead of by the other
+// holders of the key: each Lock, RLock, LockContext and RLockContext call is delivered on
+// Acquisitions and blocks until the test resolves it. TryLock and TryRLock report the result of
+// TryLockFunc, succeeding if it is nil. Unlock and RUnlock have no effect, wrap the fake in a
+// RecordingKeyLock to check them.
+type FakeKeyLock[K comparable] struct {
+	// TryLockFunc decides whether TryLock and TryRLock succeed.
+	TryLockFunc func(key K, write bool) bool
+
+	acquisitions chan *Acquisition[K]
+}
+
+var _ argosync.KeyLock[string] = &FakeKeyLock[string]{}
+
+// NewFakeKeyLock returns a FakeKeyLock.
+func NewFakeKeyLock[K comparable]() *FakeKeyLock[K] {
+	return &FakeKeyLock[K]{acquisitions: make(chan *Acquisition[K])}
+}
+
+// Acquisitions returns the channel on which attempts to acquire the lock are delivered.
+func (f *FakeKeyLock[K]) Acquisitions() <-chan *Acquisition[K] {
+	return f.acquisitions
+}
+
+// Next waits for the next attempt to acquire the lock, giving up with the context's error once ctx
+// is done.
+func (f *FakeKeyLock[K]) Next(ctx context.Context) (*Acquisition[K], error) {
+	select {
+	case a := <-f.acquisitions:
+		return a, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (f *FakeKeyLock[K]) acquire(ctx context.Context, key K, write bool) error {
+	a := &Acquisition[K]{Key: key, Write: write, result: make(chan error, 1)}
+	select {
+	case f.acquisitions <- a:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-a.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *FakeKeyLock[K]) Lock(key K) {
+	if err := f.acquire(context.Background(), key, true); err != nil {
+		panic(err)
+	}
+}
+
+func (f *FakeKeyLock[K]) Unlock(K) {}
+
+func (f *FakeKeyLock[K]) RLock(key K) {
+	if err := f.acquire(context.Background(), key, false); err != nil {
+		panic(err)
+	}
+}
+
+func (f *FakeKeyLock[K]) RUnlock(K) {}
+
+func (f *FakeKeyLock[K]) LockContext(ctx context.Context, key K) error {
+	return f.acquire(ctx, key, true)
+}
+
+func (f *FakeKeyLock[K]) RLockContext(ctx context.Context, key K) error {
+	return f.acquire(ctx, key, false)
+}
+
+func (f *FakeKeyLock[K]) TryLock(key K) bool {
+	return f.TryLockFunc == nil || f.TryLockFunc(key, true)
+}
+
+func (f *FakeKeyLock[K]) TryRLock(key K) bool {
+	return f.TryLockFunc == nil || f.TryLockFunc(key, false)
+}
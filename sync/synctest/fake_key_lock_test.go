@@ -0,0 +1,72 @@
+package synctest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeKeyLock(t *testing.T) {
+	f := NewFakeKeyLock[string]()
+
+	locked := make(chan struct{})
+	go func() {
+		f.Lock("my-key")
+		close(locked)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	a, err := f.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "my-key", a.Key)
+	assert.True(t, a.Write)
+
+	select {
+	case <-locked:
+		t.Fatal("Lock returned before the acquisition was granted")
+	default:
+	}
+	a.Grant()
+	<-locked
+	assert.Panics(t, a.Grant)
+}
+
+func TestFakeKeyLockFail(t *testing.T) {
+	f := NewFakeKeyLock[string]()
+
+	errDenied := errors.New("denied")
+	result := make(chan error)
+	go func() {
+		result <- f.RLockContext(context.Background(), "my-key")
+	}()
+	a := <-f.Acquisitions()
+	assert.False(t, a.Write)
+	a.Fail(errDenied)
+	assert.ErrorIs(t, <-result, errDenied)
+}
+
+func TestFakeKeyLockContext(t *testing.T) {
+	f := NewFakeKeyLock[string]()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, f.LockContext(ctx, "my-key"), context.DeadlineExceeded)
+	_, err := f.Next(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestFakeKeyLockTryLock(t *testing.T) {
+	f := NewFakeKeyLock[string]()
+	assert.True(t, f.TryLock("my-key"))
+
+	f.TryLockFunc = func(key string, write bool) bool {
+		return !write
+	}
+	assert.False(t, f.TryLock("my-key"))
+	assert.True(t, f.TryRLock("my-key"))
+}
@@ -0,0 +1,227 @@
+// Package synctest provides KeyLock implementations for testing code which depends on
+// sync.KeyLock: a RecordingKeyLock logging the calls made to it, assertions on that log, and a
+// FakeKeyLock whose acquisitions are decided by the test.
+package synctest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	argosync "github.com/argoproj/pkg/v2/sync"
+)
+
+// Op is an operation on a key lock.
+type Op string
+
+const (
+	OpLock    Op = "Lock"
+	OpUnlock  Op = "Unlock"
+	OpRLock   Op = "RLock"
+	OpRUnlock Op = "RUnlock"
+)
+
+// Call is a call recorded by a RecordingKeyLock.
+type Call[K comparable] struct {
+	Op  Op
+	Key K
+}
+
+func (c Call[K]) String() string {
+	return fmt.Sprintf("%s(%v)", c.Op, c.Key)
+}
+
+// RecordingKeyLock is a KeyLock which records the calls made to it before passing them on to the
+// KeyLock it wraps. Acquisitions are only recorded once they succeeded and releases before they
+// take effect, so the order of the recorded calls is the order in which the key changed hands.
+type RecordingKeyLock[K comparable] struct {
+	locks argosync.KeyLock[K]
+
+	guard sync.Mutex
+	calls []Call[K]
+}
+
+var _ argosync.KeyLock[string] = &RecordingKeyLock[string]{}
+
+// NewRecordingKeyLock returns a RecordingKeyLock wrapping l.
+func NewRecordingKeyLock[K comparable](l argosync.KeyLock[K]) *RecordingKeyLock[K] {
+	return &RecordingKeyLock[K]{locks: l}
+}
+
+func (r *RecordingKeyLock[K]) record(op Op, key K) {
+	r.guard.Lock()
+	defer r.guard.Unlock()
+	r.calls = append(r.calls, Call[K]{Op: op, Key: key})
+}
+
+// Calls returns the calls recorded so far.
+func (r *RecordingKeyLock[K]) Calls() []Call[K] {
+	r.guard.Lock()
+	defer r.guard.Unlock()
+	calls := make([]Call[K], len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+// CallsFor returns the operations recorded so far for key.
+func (r *RecordingKeyLock[K]) CallsFor(key K) []Op {
+	var ops []Op
+	for _, c := range r.Calls() {
+		if c.Key == key {
+			ops = append(ops, c.Op)
+		}
+	}
+	return ops
+}
+
+// Reset discards the calls recorded so far.
+func (r *RecordingKeyLock[K]) Reset() {
+	r.guard.Lock()
+	defer r.guard.Unlock()
+	r.calls = nil
+}
+
+func (r *RecordingKeyLock[K]) Lock(key K) {
+	r.locks.Lock(key)
+	r.record(OpLock, key)
+}
+
+func (r *RecordingKeyLock[K]) Unlock(key K) {
+	r.record(OpUnlock, key)
+	r.locks.Unlock(key)
+}
+
+func (r *RecordingKeyLock[K]) RLock(key K) {
+	r.locks.RLock(key)
+	r.record(OpRLock, key)
+}
+
+func (r *RecordingKeyLock[K]) RUnlock(key K) {
+	r.record(OpRUnlock, key)
+	r.locks.RUnlock(key)
+}
+
+func (r *RecordingKeyLock[K]) LockContext(ctx context.Context, key K) error {
+	if err := r.locks.LockContext(ctx, key); err != nil {
+		return err
+	}
+	r.record(OpLock, key)
+	return nil
+}
+
+func (r *RecordingKeyLock[K]) RLockContext(ctx context.Context, key K) error {
+	if err := r.locks.RLockContext(ctx, key); err != nil {
+		return err
+	}
+	r.record(OpRLock, key)
+	return nil
+}
+
+func (r *RecordingKeyLock[K]) TryLock(key K) bool {
+	if !r.locks.TryLock(key) {
+		return false
+	}
+	r.record(OpLock, key)
+	return true
+}
+
+func (r *RecordingKeyLock[K]) TryRLock(key K) bool {
+	if !r.locks.TryRLock(key) {
+		return false
+	}
+	r.record(OpRLock, key)
+	return true
+}
+
+// TestingT is the subset of testing.TB used by the assertions, compatible with testify's
+// assert.TestingT.
+type TestingT interface {
+	Errorf(format string, args ...any)
+}
+
+type keyState struct {
+	readers int
+	writer  bool
+}
+
+// AssertAllReleased asserts that every lock acquired through r has been released again.
+func AssertAllReleased[K comparable](t TestingT, r *RecordingKeyLock[K]) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	states := map[K]*keyState{}
+	var keys []K
+	for _, c := range r.Calls() {
+		s, ok := states[c.Key]
+		if !ok {
+			s = &keyState{}
+			states[c.Key] = s
+			keys = append(keys, c.Key)
+		}
+		switch c.Op {
+		case OpLock:
+			s.writer = true
+		case OpUnlock:
+			s.writer = false
+		case OpRLock:
+			s.readers++
+		case OpRUnlock:
+			s.readers--
+		}
+	}
+	released := true
+	for _, key := range keys {
+		if s := states[key]; s.writer || s.readers > 0 {
+			t.Errorf("key %v is still locked: write locked %t, %d readers", key, s.writer, s.readers)
+			released = false
+		}
+	}
+	return released
+}
+
+// AssertNoOverlappingWriters asserts that no key has ever been write-locked while it was held by
+// another writer or by readers, and that no key has been released without being held.
+func AssertNoOverlappingWriters[K comparable](t TestingT, r *RecordingKeyLock[K]) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+	states := map[K]*keyState{}
+	ok := true
+	for i, c := range r.Calls() {
+		s, found := states[c.Key]
+		if !found {
+			s = &keyState{}
+			states[c.Key] = s
+		}
+		var problem string
+		switch c.Op {
+		case OpLock:
+			if s.writer {
+				problem = "while write locked"
+			} else if s.readers > 0 {
+				problem = fmt.Sprintf("while held by %d readers", s.readers)
+			}
+			s.writer = true
+		case OpUnlock:
+			if !s.writer {
+				problem = "while not write locked"
+			}
+			s.writer = false
+		case OpRLock:
+			if s.writer {
+				problem = "while write locked"
+			}
+			s.readers++
+		case OpRUnlock:
+			if s.readers == 0 {
+				problem = "while not read locked"
+			}
+			s.readers = max(s.readers-1, 0)
+		}
+		if problem != "" {
+			t.Errorf("call %d: %v %s", i, c, problem)
+			ok = false
+		}
+	}
+	return ok
+}
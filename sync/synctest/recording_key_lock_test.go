@@ -0,0 +1,94 @@
+package synctest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	argosync "github.com/argoproj/pkg/v2/sync"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecordingKeyLock(t *testing.T) {
+	r := NewRecordingKeyLock(argosync.NewKeyLock())
+
+	r.Lock("a")
+	assert.False(t, r.TryRLock("a"))
+	assert.True(t, r.TryRLock("b"))
+	r.Unlock("a")
+	r.RUnlock("b")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, r.LockContext(ctx, "a"), context.Canceled)
+
+	assert.Equal(t, []Call[string]{
+		{Op: OpLock, Key: "a"},
+		{Op: OpRLock, Key: "b"},
+		{Op: OpUnlock, Key: "a"},
+		{Op: OpRUnlock, Key: "b"},
+	}, r.Calls())
+	assert.Equal(t, []Op{OpLock, OpUnlock}, r.CallsFor("a"))
+	assert.True(t, AssertAllReleased(t, r))
+	assert.True(t, AssertNoOverlappingWriters(t, r))
+
+	r.Reset()
+	assert.Empty(t, r.Calls())
+}
+
+func TestRecordingKeyLockConcurrent(t *testing.T) {
+	r := NewRecordingKeyLock(argosync.NewKeyLock())
+
+	wg := sync.WaitGroup{}
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				r.Lock("my-key")
+				r.Unlock("my-key")
+			} else {
+				r.RLock("my-key")
+				r.RUnlock("my-key")
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, r.Calls(), 100)
+	assert.True(t, AssertAllReleased(t, r))
+	assert.True(t, AssertNoOverlappingWriters(t, r))
+}
+
+func TestAssertions(t *testing.T) {
+	// FakeKeyLock lets overlapping writers through, which the assertions have to catch
+	f := NewFakeKeyLock[string]()
+	r := NewRecordingKeyLock[string](f)
+	assert.True(t, r.TryLock("a"))
+	assert.True(t, r.TryLock("a"))
+	assert.True(t, r.TryRLock("b"))
+	r.RUnlock("c")
+
+	rt := &recordingT{}
+	assert.False(t, AssertAllReleased(rt, r))
+	assert.Equal(t, []string{
+		"key a is still locked: write locked true, 0 readers",
+		"key b is still locked: write locked false, 1 readers",
+	}, rt.errors)
+
+	rt = &recordingT{}
+	assert.False(t, AssertNoOverlappingWriters(rt, r))
+	assert.Equal(t, []string{
+		"call 1: Lock(a) while write locked",
+		"call 3: RUnlock(c) while not read locked",
+	}, rt.errors)
+}
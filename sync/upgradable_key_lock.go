@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUpgradePending is returned by Upgrade when another reader of the key is already waiting to
+// upgrade. Both would wait for the other to release its read lock forever, so the later one fails.
+var ErrUpgradePending = errors.New("another upgrade of the key is pending")
+
+// UpgradableKeyLock is a KeyLock whose read locks can be upgraded to write locks and whose write
+// locks can be downgraded to read locks without releasing the key in between.
+type UpgradableKeyLock[K comparable] interface {
+	KeyLock[K]
+	// Upgrade converts the caller's read lock on key into the write lock once all other readers have
+	// released theirs. No new readers or writers acquire the key while an upgrade is pending. It fails
+	// fast with ErrUpgradePending if another reader is already upgrading, and with the context's error
+	// once ctx is done. On failure the caller still holds its read lock.
+	Upgrade(ctx context.Context, key K) error
+	// Downgrade atomically converts the caller's write lock on key into a read lock.
+	Downgrade(key K)
+}
+
+// NewUpgradableKeyLock returns an UpgradableKeyLock for keys of type K which grants each key to its
+// waiters according to the given policy.
+func NewUpgradableKeyLock[K comparable](policy FairnessPolicy) UpgradableKeyLock[K] {
+	return NewKeyLockWithPolicy[K](policy).(*keyLock[K])
+}
+
+func (l *keyLock[K]) Upgrade(ctx context.Context, key K) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.guard.Lock()
+	entry, ok := l.locks[key]
+	if !ok || entry.readers == 0 {
+		l.guard.Unlock()
+		panic("sync: Upgrade of key which is not read-locked")
+	}
+	if entry.upgrader != nil {
+		l.guard.Unlock()
+		return ErrUpgradePending
+	}
+	if entry.readers == 1 {
+		entry.readers = 0
+		entry.writer = true
+		l.guard.Unlock()
+		return nil
+	}
+	w := &waiter{write: true, ready: make(chan struct{})}
+	entry.upgrader = w
+	l.guard.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	if entry.upgrader == w {
+		entry.upgrader = nil
+	} else {
+		// the upgrade completed while the context got cancelled, undo it
+		entry.writer = false
+		entry.readers++
+	}
+	// readers and writers queued during the upgrade may proceed again
+	entry.grant(l.policy)
+	return ctx.Err()
+}
+
+func (l *keyLock[K]) Downgrade(key K) {
+	l.guard.Lock()
+	defer l.guard.Unlock()
+	entry, ok := l.locks[key]
+	if !ok || !entry.writer {
+		panic("sync: Downgrade of key which is not write-locked")
+	}
+	entry.writer = false
+	entry.readers++
+	entry.grant(l.policy)
+}
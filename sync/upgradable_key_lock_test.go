@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func upgrading(l UpgradableKeyLock[string], key string) bool {
+	kl := l.(*keyLock[string])
+	kl.guard.Lock()
+	defer kl.guard.Unlock()
+	entry, ok := kl.locks[key]
+	return ok && entry.upgrader != nil
+}
+
+func TestUpgradeSoleReader(t *testing.T) {
+	l := NewUpgradableKeyLock[string](FairnessFIFO)
+
+	l.RLock("my-key")
+	require.NoError(t, l.Upgrade(context.Background(), "my-key"))
+	assert.False(t, l.TryRLock("my-key"))
+	l.Unlock("my-key")
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestUpgradeWaitsForReaders(t *testing.T) {
+	l := NewUpgradableKeyLock[string](FairnessFIFO)
+
+	l.RLock("my-key")
+	l.RLock("my-key")
+
+	done := make(chan error)
+	go func() {
+		done <- l.Upgrade(context.Background(), "my-key")
+	}()
+	require.Eventually(t, func() bool {
+		return upgrading(l, "my-key")
+	}, time.Second, time.Millisecond)
+
+	// nobody else gets in while the upgrade is pending
+	assert.False(t, l.TryRLock("my-key"))
+	require.ErrorIs(t, l.Upgrade(context.Background(), "my-key"), ErrUpgradePending)
+
+	l.RUnlock("my-key")
+	require.NoError(t, <-done)
+	assert.False(t, l.TryRLock("my-key"))
+	l.Unlock("my-key")
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestUpgradeBeforeQueuedWriter(t *testing.T) {
+	l := NewUpgradableKeyLock[string](FairnessFIFO)
+
+	l.RLock("my-key")
+	l.RLock("my-key")
+
+	writerDone := make(chan struct{})
+	go func() {
+		l.Lock("my-key")
+		close(writerDone)
+	}()
+	require.Eventually(t, func() bool {
+		return waiters(l, "my-key") == 1
+	}, time.Second, time.Millisecond)
+
+	upgradeDone := make(chan error)
+	go func() {
+		upgradeDone <- l.Upgrade(context.Background(), "my-key")
+	}()
+	require.Eventually(t, func() bool {
+		return upgrading(l, "my-key")
+	}, time.Second, time.Millisecond)
+
+	l.RUnlock("my-key")
+	require.NoError(t, <-upgradeDone)
+	l.Unlock("my-key")
+	<-writerDone
+	l.Unlock("my-key")
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestUpgradeContext(t *testing.T) {
+	l := NewUpgradableKeyLock[string](FairnessFIFO)
+
+	l.RLock("my-key")
+	l.RLock("my-key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, l.Upgrade(ctx, "my-key"), context.DeadlineExceeded)
+
+	// both read locks are still held
+	assert.False(t, upgrading(l, "my-key"))
+	assert.False(t, l.TryLock("my-key"))
+	assert.True(t, l.TryRLock("my-key"))
+	l.RUnlock("my-key")
+	l.RUnlock("my-key")
+	l.RUnlock("my-key")
+
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestDowngrade(t *testing.T) {
+	l := NewUpgradableKeyLock[string](FairnessFIFO)
+
+	l.Lock("my-key")
+
+	readerDone := make(chan struct{})
+	go func() {
+		l.RLock("my-key")
+		close(readerDone)
+	}()
+	require.Eventually(t, func() bool {
+		return waiters(l, "my-key") == 1
+	}, time.Second, time.Millisecond)
+
+	l.Downgrade("my-key")
+	<-readerDone
+	assert.False(t, l.TryLock("my-key"))
+
+	l.RUnlock("my-key")
+	l.RUnlock("my-key")
+	assert.Empty(t, l.(*keyLock[string]).locks)
+}
+
+func TestUpgradeDowngradeMisuse(t *testing.T) {
+	l := NewUpgradableKeyLock[string](FairnessFIFO)
+
+	assert.Panics(t, func() {
+		_ = l.Upgrade(context.Background(), "my-key")
+	})
+	assert.Panics(t, func() {
+		l.Downgrade("my-key")
+	})
+}
@@ -0,0 +1,90 @@
+package time
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewFakeClock(start)
+	var clock Clock = fake
+
+	after := clock.After(time.Minute)
+	timer := clock.NewTimer(time.Hour)
+	ticker := clock.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	fake.Step(30 * time.Second)
+	assert.Equal(t, start.Add(30*time.Second), <-ticker.C())
+	assert.Empty(t, after)
+
+	fake.Step(30 * time.Second)
+	assert.Equal(t, start.Add(time.Minute), <-after)
+	assert.Equal(t, start.Add(time.Minute), <-ticker.C())
+	assert.Equal(t, time.Minute, clock.Since(start))
+
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop())
+	fake.Step(time.Hour)
+	assert.Empty(t, timer.C())
+
+	// a ticker which is not read drops ticks
+	assert.Equal(t, start.Add(time.Hour+time.Minute), <-ticker.C())
+	assert.Empty(t, ticker.C())
+	ticker.Stop()
+	assert.False(t, fake.HasWaiters())
+}
+
+func TestFakeClockTimerReset(t *testing.T) {
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	fake := NewFakeClock(start)
+
+	timer := fake.NewTimer(time.Second)
+	fake.Step(500 * time.Millisecond)
+	assert.True(t, timer.Reset(time.Second))
+	fake.Step(500 * time.Millisecond)
+	assert.Empty(t, timer.C())
+	assert.True(t, fake.HasWaiters())
+
+	fake.SetTime(start.Add(2 * time.Second))
+	assert.Equal(t, start.Add(2*time.Second), <-timer.C())
+	assert.False(t, fake.HasWaiters())
+
+	assert.False(t, timer.Reset(0))
+	assert.Equal(t, start.Add(2*time.Second), <-timer.C())
+}
+
+func TestRealClock(t *testing.T) {
+	var clock Clock = RealClock{}
+
+	assert.WithinDuration(t, time.Now(), clock.Now(), time.Second)
+	timer := clock.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(t, timer.Stop())
+	ticker := clock.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+	<-clock.After(time.Millisecond)
+}
+
+func TestFakeClockAfterFunc(t *testing.T) {
+	fake := NewFakeClock(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+
+	called := make(chan struct{})
+	fake.AfterFunc(time.Second, func() {
+		// runs on its own goroutine, so it may use the clock
+		_ = fake.Now()
+		close(called)
+	})
+	stopped := fake.AfterFunc(time.Second, func() {
+		t.Error("stopped AfterFunc called")
+	})
+	assert.True(t, stopped.Stop())
+
+	fake.Step(time.Second)
+	<-called
+	assert.False(t, fake.HasWaiters())
+}
@@ -0,0 +1,164 @@
+package time
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock whose time only moves when it is stepped or set, firing the timers and
+// tickers which are due at that point. Like their real counterparts, timers and tickers buffer a
+// single tick and drop further ticks until it has been received.
+type FakeClock struct {
+	guard   sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a timer or, if period is positive, a ticker of a FakeClock. Timers created by
+// AfterFunc call f instead of sending to c.
+type fakeWaiter struct {
+	clock  *FakeClock
+	target time.Time
+	period time.Duration
+	c      chan time.Time
+	f      func()
+}
+
+var _ Clock = &FakeClock{}
+
+// NewFakeClock returns a FakeClock set to t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+func (f *FakeClock) Now() time.Time {
+	f.guard.Lock()
+	defer f.guard.Unlock()
+	return f.now
+}
+
+func (f *FakeClock) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	return f.add(d, 0, nil)
+}
+
+// AfterFunc calls fn on its own goroutine once the clock has been moved forward by d.
+func (f *FakeClock) AfterFunc(d time.Duration, fn func()) Timer {
+	return f.add(d, 0, fn)
+}
+
+// NewTicker returns a Ticker ticking every d. It panics if d is not positive.
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for FakeClock.NewTicker")
+	}
+	return &fakeTicker{waiter: f.add(d, d, nil)}
+}
+
+func (f *FakeClock) add(d, period time.Duration, fn func()) *fakeWaiter {
+	f.guard.Lock()
+	defer f.guard.Unlock()
+	w := &fakeWaiter{clock: f, target: f.now.Add(d), period: period, c: make(chan time.Time, 1), f: fn}
+	f.waiters = append(f.waiters, w)
+	f.fire()
+	return w
+}
+
+// Step moves the clock forward by d.
+func (f *FakeClock) Step(d time.Duration) {
+	f.guard.Lock()
+	defer f.guard.Unlock()
+	f.now = f.now.Add(d)
+	f.fire()
+}
+
+// SetTime sets the clock to t.
+func (f *FakeClock) SetTime(t time.Time) {
+	f.guard.Lock()
+	defer f.guard.Unlock()
+	f.now = t
+	f.fire()
+}
+
+// HasWaiters reports whether any timer or ticker is pending.
+func (f *FakeClock) HasWaiters() bool {
+	f.guard.Lock()
+	defer f.guard.Unlock()
+	return len(f.waiters) > 0
+}
+
+// fire sends a tick to every waiter which is due, removing timers and rescheduling tickers. It must
+// be called with the guard held.
+func (f *FakeClock) fire() {
+	f.waiters = slices.DeleteFunc(f.waiters, func(w *fakeWaiter) bool {
+		if w.target.After(f.now) {
+			return false
+		}
+		if w.f != nil {
+			go w.f()
+		} else {
+			select {
+			case w.c <- f.now:
+			default:
+			}
+		}
+		if w.period <= 0 {
+			return true
+		}
+		for !w.target.After(f.now) {
+			w.target = w.target.Add(w.period)
+		}
+		return false
+	})
+}
+
+// remove removes w and reports whether it was pending. It must be called with the guard held.
+func (f *FakeClock) remove(w *fakeWaiter) bool {
+	i := slices.Index(f.waiters, w)
+	if i < 0 {
+		return false
+	}
+	f.waiters = slices.Delete(f.waiters, i, i+1)
+	return true
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.guard.Lock()
+	defer w.clock.guard.Unlock()
+	return w.clock.remove(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	f := w.clock
+	f.guard.Lock()
+	defer f.guard.Unlock()
+	pending := f.remove(w)
+	w.target = f.now.Add(d)
+	f.waiters = append(f.waiters, w)
+	f.fire()
+	return pending
+}
+
+type fakeTicker struct {
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.waiter.Stop()
+}
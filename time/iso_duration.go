@@ -0,0 +1,260 @@
+package time
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoDateUnits and isoTimeUnits are the designators of the components of an ISO 8601 duration in the order they have to
+// appear in, the date components before the 'T' and the time components after it.
+const (
+	isoDateUnits = "YMWD"
+	isoTimeUnits = "HMS"
+)
+
+// ISODuration is an ISO 8601 duration such as P1DT2H or PT30M. Years, months, weeks and days are
+// calendar components whose length depends on the time they are added to, so they are kept apart
+// from the exact time components.
+type ISODuration struct {
+	// Negative reports whether the duration points into the past, written as -P1D.
+	Negative bool
+	Years    int
+	Months   int
+	Weeks    int
+	Days     int
+	// Duration is the sum of the hours, minutes and seconds. It is never negative in a parsed
+	// duration, whose sign is held by Negative.
+	Duration time.Duration
+}
+
+// ParseISODuration parses an ISO 8601 duration such as P1Y2M3DT4H5M6.5S, P2W or -PT30M. Only the
+// last component, which has to be hours, minutes or seconds, may have a fraction, and the years,
+// months, weeks and days may not exceed math.MaxInt32 each. Malformed durations are reported as a
+// *ParseError.
+func ParseISODuration(duration string) (ISODuration, error) {
+	s := duration
+	fail := func(reason string) (ISODuration, error) {
+		return ISODuration{}, &ParseError{Kind: "ISO 8601 duration", Input: duration, Offset: len(duration) - len(s), Reason: reason}
+	}
+
+	var d ISODuration
+	if strings.HasPrefix(s, "-") {
+		d.Negative = true
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") {
+		return fail("expected 'P'")
+	}
+	s = s[1:]
+	if s == "" {
+		return fail("expected at least one component (e.g. P1D or PT30M)")
+	}
+
+	units := isoDateUnits
+	inTime := false
+	// last is the index in units of the previous component
+	last := -1
+	fraction := false
+	var total uint64
+	for s != "" {
+		if s[0] == 'T' {
+			if inTime {
+				return fail("unexpected 'T'")
+			}
+			inTime = true
+			units = isoTimeUnits
+			last = -1
+			s = s[1:]
+			if s == "" {
+				return fail("expected a time component after 'T'")
+			}
+			continue
+		}
+		if fraction {
+			return fail("only the last component may have a fraction")
+		}
+
+		start := s
+		v, rest, ok := leadingInt(s)
+		if !ok {
+			return fail("duration out of range")
+		}
+		if len(rest) == len(s) {
+			return fail("expected a number")
+		}
+		s = rest
+		var f uint64
+		scale := 1.0
+		if s != "" && (s[0] == '.' || s[0] == ',') {
+			s = s[1:]
+			pl := len(s)
+			f, scale, s = leadingFraction(s)
+			if pl == len(s) {
+				return fail("expected a number")
+			}
+			fraction = true
+		}
+
+		if s == "" {
+			return fail("missing unit")
+		}
+		i := strings.IndexByte(units, s[0])
+		if i < 0 {
+			if !inTime && strings.IndexByte(isoTimeUnits, s[0]) >= 0 {
+				return fail(fmt.Sprintf("unit '%c' has to follow 'T'", s[0]))
+			}
+			return fail(fmt.Sprintf("unknown unit '%c'", s[0]))
+		}
+		if i <= last {
+			return fail(fmt.Sprintf("unit '%c' out of order", s[0]))
+		}
+		last = i
+
+		if !inTime {
+			if fraction {
+				return fail("only hours, minutes and seconds may have a fraction")
+			}
+			// keep the calendar components small enough for AddTo to add them without overflowing
+			if v > math.MaxInt32 {
+				s = start
+				return fail("duration out of range")
+			}
+			switch s[0] {
+			case 'Y':
+				d.Years = int(v)
+			case 'M':
+				d.Months = int(v)
+			case 'W':
+				d.Weeks = int(v)
+			case 'D':
+				d.Days = int(v)
+			}
+			s = s[1:]
+			continue
+		}
+
+		unit := uint64(time.Second)
+		switch s[0] {
+		case 'H':
+			unit = uint64(time.Hour)
+		case 'M':
+			unit = uint64(time.Minute)
+		}
+		if v > 1<<63/unit {
+			s = start
+			return fail("duration out of range")
+		}
+		v *= unit
+		if f > 0 {
+			v += uint64(float64(f) * (float64(unit) / scale))
+		}
+		total += v
+		if v > 1<<63-1 || total > 1<<63-1 {
+			s = start
+			return fail("duration out of range")
+		}
+		s = s[1:]
+	}
+	d.Duration = time.Duration(total)
+	return d, nil
+}
+
+// AddTo returns t plus the duration, adding the calendar components with time.Time.AddDate before
+// the time components.
+func (d ISODuration) AddTo(t time.Time) time.Time {
+	if d.Negative {
+		return t.AddDate(-d.Years, -d.Months, -7*d.Weeks-d.Days).Add(-d.Duration)
+	}
+	return t.AddDate(d.Years, d.Months, 7*d.Weeks+d.Days).Add(d.Duration)
+}
+
+// Resolve returns the exact length of the duration when added to ref, e.g. P1M is 744h in October
+// but 672h in February of a non-leap year.
+func (d ISODuration) Resolve(ref time.Time) time.Duration {
+	return d.AddTo(ref).Sub(ref)
+}
+
+// String formats the duration in ISO 8601, e.g. P1DT2H. The zero duration is formatted as PT0S. If
+// none of the components is positive, their sign is folded into Negative, e.g. a Duration of -1h is
+// formatted as -PT1H. Components with different signs have no ISO 8601 representation, so the
+// negative ones are written with a minus sign, e.g. P1DT-1H, which ParseISODuration rejects.
+func (d ISODuration) String() string {
+	// the time components are written by their magnitude, as -Duration overflows for math.MinInt64
+	u := uint64(d.Duration)
+	if d.Duration < 0 {
+		u = -u
+	}
+	folded := d.Years <= 0 && d.Months <= 0 && d.Weeks <= 0 && d.Days <= 0 && d.Duration <= 0 &&
+		d != (ISODuration{Negative: d.Negative})
+	if folded {
+		d = ISODuration{Negative: !d.Negative, Years: -d.Years, Months: -d.Months, Weeks: -d.Weeks, Days: -d.Days}
+	}
+	var b strings.Builder
+	if d.Negative {
+		b.WriteByte('-')
+	}
+	b.WriteByte('P')
+	calendar := false
+	for _, c := range []struct {
+		v    int
+		unit byte
+	}{{d.Years, 'Y'}, {d.Months, 'M'}, {d.Weeks, 'W'}, {d.Days, 'D'}} {
+		if c.v != 0 {
+			b.WriteString(strconv.Itoa(c.v))
+			b.WriteByte(c.unit)
+			calendar = true
+		}
+	}
+	if u != 0 || !calendar {
+		b.WriteByte('T')
+		if d.Duration < 0 {
+			b.WriteByte('-')
+		}
+		writeISOTime(&b, u)
+	}
+	return b.String()
+}
+
+// FormatISODuration formats d in ISO 8601 using hours, minutes and seconds only, e.g. PT26H or
+// -PT1.5S, as a time.Duration has no notion of calendar days.
+func FormatISODuration(d time.Duration) string {
+	var b strings.Builder
+	u := uint64(d)
+	if d < 0 {
+		b.WriteByte('-')
+		u = -u
+	}
+	b.WriteString("PT")
+	writeISOTime(&b, u)
+	return b.String()
+}
+
+// writeISOTime writes the time components of a duration of d nanoseconds following the 'T'.
+func writeISOTime(b *strings.Builder, d uint64) {
+	if d == 0 {
+		b.WriteString("0S")
+		return
+	}
+	hours := d / uint64(time.Hour)
+	minutes := d / uint64(time.Minute) % 60
+	seconds := d / uint64(time.Second) % 60
+	nanos := d % uint64(time.Second)
+	if hours > 0 {
+		b.WriteString(strconv.FormatUint(hours, 10))
+		b.WriteByte('H')
+	}
+	if minutes > 0 {
+		b.WriteString(strconv.FormatUint(minutes, 10))
+		b.WriteByte('M')
+	}
+	if seconds > 0 || nanos > 0 {
+		b.WriteString(strconv.FormatUint(seconds, 10))
+		if nanos > 0 {
+			b.WriteString(strings.TrimRight(fmt.Sprintf(".%09d", nanos), "0"))
+		}
+		b.WriteByte('S')
+	}
+}
@@ -0,0 +1,156 @@
+package time
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseISODuration tests parsing and formatting of ISO 8601 durations
+func TestParseISODuration(t *testing.T) {
+	type testData struct {
+		duration string
+		xVal     ISODuration
+		xString  string
+	}
+	testdata := []testData{
+		{"PT30M", ISODuration{Duration: 30 * time.Minute}, "PT30M"},
+		{"P1DT2H", ISODuration{Days: 1, Duration: 2 * time.Hour}, "P1DT2H"},
+		{"P1Y2M3DT4H5M6S", ISODuration{Years: 1, Months: 2, Days: 3, Duration: 4*time.Hour + 5*time.Minute + 6*time.Second}, "P1Y2M3DT4H5M6S"},
+		{"P2W", ISODuration{Weeks: 2}, "P2W"},
+		{"P1M", ISODuration{Months: 1}, "P1M"},
+		{"PT1M", ISODuration{Duration: time.Minute}, "PT1M"},
+		{"-P1D", ISODuration{Negative: true, Days: 1}, "-P1D"},
+		{"PT0S", ISODuration{}, "PT0S"},
+		{"P0D", ISODuration{}, "PT0S"},
+		{"PT1.5H", ISODuration{Duration: 90 * time.Minute}, "PT1H30M"},
+		{"PT0,5S", ISODuration{Duration: 500 * time.Millisecond}, "PT0.5S"},
+		{"PT1M0.000000001S", ISODuration{Duration: time.Minute + time.Nanosecond}, "PT1M0.000000001S"},
+		{"PT90M", ISODuration{Duration: 90 * time.Minute}, "PT1H30M"},
+		{"PT36H", ISODuration{Duration: 36 * time.Hour}, "PT36H"},
+		{"PT2562047H47M16.854775807S", ISODuration{Duration: 1<<63 - 1}, "PT2562047H47M16.854775807S"},
+	}
+	for _, data := range testdata {
+		d, err := ParseISODuration(data.duration)
+		require.NoError(t, err, data.duration)
+		assert.Equal(t, data.xVal, d, data.duration)
+		assert.Equal(t, data.xString, d.String(), data.duration)
+	}
+}
+
+// TestParseISODurationError tests the position and reason of ISO 8601 parse errors
+func TestParseISODurationError(t *testing.T) {
+	type testData struct {
+		duration string
+		offset   int
+		reason   string
+	}
+	testdata := []testData{
+		{"", 0, "expected 'P'"},
+		{"1D", 0, "expected 'P'"},
+		{"P", 1, "expected at least one component (e.g. P1D or PT30M)"},
+		{"PT", 2, "expected a time component after 'T'"},
+		{"P1DT", 4, "expected a time component after 'T'"},
+		{"PT1HT", 4, "unexpected 'T'"},
+		{"PD", 1, "expected a number"},
+		{"P1", 2, "missing unit"},
+		{"P1H", 2, "unit 'H' has to follow 'T'"},
+		{"P1X", 2, "unknown unit 'X'"},
+		{"PT1D", 3, "unknown unit 'D'"},
+		{"P1D1Y", 4, "unit 'Y' out of order"},
+		{"PT1S1M", 5, "unit 'M' out of order"},
+		{"P1M1M", 4, "unit 'M' out of order"},
+		{"P1.5D", 4, "only hours, minutes and seconds may have a fraction"},
+		{"PT1.5H30M", 6, "only the last component may have a fraction"},
+		{"PT1.S", 4, "expected a number"},
+		{"P99999999999999999999D", 1, "duration out of range"},
+		{"P2147483648Y", 1, "duration out of range"},
+		{"P1Y2147483648W", 3, "duration out of range"},
+		{"PT2562048H", 2, "duration out of range"},
+		{"PT2562047H47M16.854775808S", 13, "duration out of range"},
+	}
+	for _, data := range testdata {
+		_, err := ParseISODuration(data.duration)
+		var parseErr *ParseError
+		require.ErrorAs(t, err, &parseErr, data.duration)
+		assert.Equal(t, &ParseError{Kind: "ISO 8601 duration", Input: data.duration, Offset: data.offset, Reason: data.reason}, parseErr, data.duration)
+	}
+
+	_, err := ParseISODuration("P1X")
+	assert.EqualError(t, err, "invalid ISO 8601 duration 'P1X' at offset 2: unknown unit 'X'")
+}
+
+// TestISODurationResolve tests resolving calendar components against a reference time
+func TestISODurationResolve(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	type testData struct {
+		duration string
+		ref      time.Time
+		xVal     time.Duration
+	}
+	testdata := []testData{
+		{"PT30M", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), 30 * time.Minute},
+		{"P1M", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), 31 * 24 * time.Hour},
+		{"P1M", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), 28 * 24 * time.Hour},
+		{"P1Y", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), 366 * 24 * time.Hour},
+		{"P1W", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), 7 * 24 * time.Hour},
+		{"P1DT2H", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), 26 * time.Hour},
+		// the day the clocks go back in Berlin is 25 hours long
+		{"P1D", time.Date(2026, 10, 25, 0, 0, 0, 0, berlin), 25 * time.Hour},
+		{"-P1M", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), -28 * 24 * time.Hour},
+		{"-P1DT1H", time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), -25 * time.Hour},
+	}
+	for _, data := range testdata {
+		d, err := ParseISODuration(data.duration)
+		require.NoError(t, err, data.duration)
+		assert.Equal(t, data.xVal, d.Resolve(data.ref), data.duration)
+		assert.Equal(t, data.ref.Add(data.xVal), d.AddTo(data.ref), data.duration)
+	}
+}
+
+// TestISODurationString tests formatting of durations which were not parsed
+func TestISODurationString(t *testing.T) {
+	type testData struct {
+		duration ISODuration
+		xVal     string
+	}
+	testdata := []testData{
+		{ISODuration{Duration: -90 * time.Minute}, "-PT1H30M"},
+		{ISODuration{Negative: true, Duration: -time.Hour}, "PT1H"},
+		{ISODuration{Days: -1, Duration: -time.Hour}, "-P1DT1H"},
+		{ISODuration{Negative: true}, "-PT0S"},
+		{ISODuration{Duration: -1 << 63}, "-PT2562047H47M16.854775808S"},
+		{ISODuration{Days: 1, Duration: -time.Hour}, "P1DT-1H"},
+	}
+	for _, data := range testdata {
+		assert.Equal(t, data.xVal, data.duration.String())
+	}
+
+	d, err := ParseISODuration("P2147483647Y2147483647W2147483647D")
+	require.NoError(t, err)
+	assert.Equal(t, math.MaxInt32, d.Years)
+}
+
+// TestFormatISODuration tests formatting of time.Duration values in ISO 8601
+func TestFormatISODuration(t *testing.T) {
+	type testData struct {
+		duration time.Duration
+		xVal     string
+	}
+	testdata := []testData{
+		{0, "PT0S"},
+		{time.Nanosecond, "PT0.000000001S"},
+		{1500 * time.Millisecond, "PT1.5S"},
+		{-1500 * time.Millisecond, "-PT1.5S"},
+		{26*time.Hour + 3*time.Second, "PT26H3S"},
+		{-1 << 63, "-PT2562047H47M16.854775808S"},
+	}
+	for _, data := range testdata {
+		assert.Equal(t, data.xVal, FormatISODuration(data.duration))
+	}
+}
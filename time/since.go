@@ -0,0 +1,117 @@
+package time
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SinceForm is the form of a since expression recognized by ParseSinceTime.
+type SinceForm string
+
+const (
+	// SinceRelative is a duration before now, e.g. 3h.
+	SinceRelative SinceForm = "Relative"
+	// SinceNow is now, optionally minus a duration, e.g. now-2h.
+	SinceNow SinceForm = "Now"
+	// SinceKeyword is the start of a day in UTC named by a keyword, i.e. today or yesterday.
+	SinceKeyword SinceForm = "Keyword"
+	// SinceDate is the start of a day, e.g. 2026-10-01.
+	SinceDate SinceForm = "Date"
+	// SinceRFC3339 is a timestamp in RFC 3339 format, e.g. 2026-10-01T12:00:00Z.
+	SinceRFC3339 SinceForm = "RFC3339"
+	// SinceRFC3339Nano is a timestamp in RFC 3339 format with fractional seconds, e.g.
+	// 2026-10-01T12:00:00.5Z.
+	SinceRFC3339Nano SinceForm = "RFC3339Nano"
+	// SinceUnix is a number of seconds since the Unix epoch, e.g. 1790000000.
+	SinceUnix SinceForm = "Unix"
+	// SinceUnixMilli is a number of milliseconds since the Unix epoch, e.g. 1790000000000.
+	SinceUnixMilli SinceForm = "UnixMilli"
+)
+
+// unixMilliThreshold is the smallest number taken as milliseconds rather than seconds since the
+// epoch. As seconds it would be in the year 5138, as milliseconds it is in 1973.
+const unixMilliThreshold = 100_000_000_000
+
+// ParseSinceTime parses a since expression and returns the time in UTC together with the form it
+// was given in. Besides durations accepted by ParseDuration, which are taken relative to now, it
+// accepts RFC 3339 timestamps, Unix epoch seconds or milliseconds, dates such as 2026-10-01 (the
+// start of the day in UTC), now, now minus a duration such as now-2h, today and yesterday. Like
+// dates, today and yesterday are resolved to the start of the day in UTC rather than in the local
+// time zone of the clock. Malformed expressions are reported as a *ParseError.
+func ParseSinceTime(since string) (time.Time, SinceForm, error) {
+	return ParseSinceTimeWithClock(RealClock{}, since)
+}
+
+// ParseSinceTimeWithClock is like ParseSinceTime but takes the current time from the given clock.
+func ParseSinceTimeWithClock(clock Clock, since string) (time.Time, SinceForm, error) {
+	now := clock.Now().UTC()
+	fail := func(offset int, reason string) (time.Time, SinceForm, error) {
+		return time.Time{}, "", &ParseError{Kind: "since expression", Input: since, Offset: offset, Reason: reason}
+	}
+	switch {
+	case since == "":
+		return fail(0, "expected a duration, timestamp, date or now-<duration>")
+	case since == "today":
+		return startOfDay(now), SinceKeyword, nil
+	case since == "yesterday":
+		return startOfDay(now).AddDate(0, 0, -1), SinceKeyword, nil
+	case since == "now":
+		return now, SinceNow, nil
+	case strings.HasPrefix(since, "now"):
+		if since[3] != '-' {
+			return fail(3, "expected '-' after now")
+		}
+		dur, err := ParseDuration(since[4:])
+		if err != nil {
+			parseErr := err.(*ParseError)
+			return fail(4+parseErr.Offset, parseErr.Reason)
+		}
+		return now.Add(-*dur), SinceNow, nil
+	case isDigits(since):
+		n, err := strconv.ParseInt(since, 10, 64)
+		if err != nil {
+			return fail(0, "timestamp out of range")
+		}
+		if n >= unixMilliThreshold {
+			return time.UnixMilli(n).UTC(), SinceUnixMilli, nil
+		}
+		return time.Unix(n, 0).UTC(), SinceUnix, nil
+	case len(since) >= 10 && isDigits(since[:4]) && since[4] == '-':
+		if len(since) == len(time.DateOnly) {
+			t, err := time.Parse(time.DateOnly, since)
+			if err != nil {
+				return fail(0, fmt.Sprintf("expected a date formatted as %s", time.DateOnly))
+			}
+			return t, SinceDate, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, since)
+		if err != nil {
+			return fail(0, fmt.Sprintf("expected a timestamp formatted as %s", time.RFC3339))
+		}
+		if strings.Contains(since, ".") {
+			return t.UTC(), SinceRFC3339Nano, nil
+		}
+		return t.UTC(), SinceRFC3339, nil
+	}
+	dur, err := ParseDuration(since)
+	if err != nil {
+		return time.Time{}, "", withKind(err, "since expression")
+	}
+	return now.Add(-*dur), SinceRelative, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,80 @@
+package time
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseSinceTime tests parsing of absolute and relative since expressions
+func TestParseSinceTime(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 10, 2, 1, 30, 0, 0, time.FixedZone("CEST", 2*60*60)))
+	now := time.Date(2026, 10, 1, 23, 30, 0, 0, time.UTC)
+
+	type testData struct {
+		since string
+		xVal  time.Time
+		xForm SinceForm
+	}
+	testdata := []testData{
+		{"3h", now.Add(-3 * time.Hour), SinceRelative},
+		{"1h30m", now.Add(-90 * time.Minute), SinceRelative},
+		{"now", now, SinceNow},
+		{"now-2h", now.Add(-2 * time.Hour), SinceNow},
+		{"now-1.5d", now.Add(-36 * time.Hour), SinceNow},
+		// it is already October 2nd on the clock, but still October 1st in UTC
+		{"today", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), SinceKeyword},
+		{"yesterday", time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC), SinceKeyword},
+		{"2026-10-01", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), SinceDate},
+		{"2024-02-29", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), SinceDate},
+		{"2026-10-01T12:00:00Z", time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC), SinceRFC3339},
+		{"2026-10-01T12:00:00+02:00", time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), SinceRFC3339},
+		{"2026-10-01T12:00:00.123456789Z", time.Date(2026, 10, 1, 12, 0, 0, 123456789, time.UTC), SinceRFC3339Nano},
+		{"2026-10-01T12:00:00.5-01:00", time.Date(2026, 10, 1, 13, 0, 0, 500000000, time.UTC), SinceRFC3339Nano},
+		{"0", time.Unix(0, 0).UTC(), SinceUnix},
+		{"1790000000", time.Unix(1790000000, 0).UTC(), SinceUnix},
+		{"99999999999", time.Unix(99999999999, 0).UTC(), SinceUnix},
+		{"100000000000", time.UnixMilli(100000000000).UTC(), SinceUnixMilli},
+		{"1790000000123", time.UnixMilli(1790000000123).UTC(), SinceUnixMilli},
+	}
+	for _, data := range testdata {
+		since, form, err := ParseSinceTimeWithClock(clock, data.since)
+		require.NoError(t, err, data.since)
+		assert.Equal(t, data.xVal, since, data.since)
+		assert.Equal(t, time.UTC, since.Location(), data.since)
+		assert.Equal(t, data.xForm, form, data.since)
+	}
+
+	since, form, err := ParseSinceTime("now-1h")
+	require.NoError(t, err)
+	assert.Equal(t, SinceNow, form)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), since, time.Minute)
+}
+
+// TestParseSinceTimeError tests the position and reason of since parse errors
+func TestParseSinceTimeError(t *testing.T) {
+	type testData struct {
+		since  string
+		offset int
+		reason string
+	}
+	testdata := []testData{
+		{"", 0, "expected a duration, timestamp, date or now-<duration>"},
+		{"now+2h", 3, "expected '-' after now"},
+		{"now-", 4, "expected format <duration><unit> (e.g. 3h or 1h30m)"},
+		{"now-2x", 5, "unknown unit 'x'"},
+		{"tomorrow", 0, "expected a number"},
+		{"2026-13-01", 0, "expected a date formatted as 2006-01-02"},
+		{"2026-10-01T25:00:00Z", 0, "expected a timestamp formatted as 2006-01-02T15:04:05Z07:00"},
+		{"2026-10-01 12:00:00", 0, "expected a timestamp formatted as 2006-01-02T15:04:05Z07:00"},
+		{"99999999999999999999", 0, "timestamp out of range"},
+	}
+	for _, data := range testdata {
+		_, _, err := ParseSinceTimeWithClock(NewFakeClock(time.Now()), data.since)
+		var parseErr *ParseError
+		require.ErrorAs(t, err, &parseErr, data.since)
+		assert.Equal(t, &ParseError{Kind: "since expression", Input: data.since, Offset: data.offset, Reason: data.reason}, parseErr, data.since)
+	}
+}
@@ -2,45 +2,180 @@ package time
 
 import (
 	"fmt"
-	"log"
-	"regexp"
-	"strconv"
 	"time"
 )
 
-var durationRegex = regexp.MustCompile(`^(\d+)([smhd])$`)
+const day = 24 * time.Hour
 
-// ParseDuration parses a duration string and returns the time.Duration
+var unitMap = map[string]uint64{
+	"ns": uint64(time.Nanosecond),
+	"us": uint64(time.Microsecond),
+	"µs": uint64(time.Microsecond), // U+00B5 = micro symbol
+	"μs": uint64(time.Microsecond), // U+03BC = Greek letter mu
+	"ms": uint64(time.Millisecond),
+	"s":  uint64(time.Second),
+	"m":  uint64(time.Minute),
+	"h":  uint64(time.Hour),
+	"d":  uint64(day),
+	"w":  uint64(7 * day),
+}
+
+// ParseError describes a string which could not be parsed.
+type ParseError struct {
+	// Kind names what was being parsed, e.g. "duration".
+	Kind string
+	// Input is the string being parsed.
+	Input string
+	// Offset is the byte offset in Input at which parsing failed.
+	Offset int
+	// Reason describes what is wrong at Offset.
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid %s '%s' at offset %d: %s", e.Kind, e.Input, e.Offset, e.Reason)
+}
+
+// withKind returns err, which has to be a *ParseError, as a ParseError of the given kind.
+func withKind(err error, kind string) error {
+	parseErr := *err.(*ParseError)
+	parseErr.Kind = kind
+	return &parseErr
+}
+
+// ParseDuration parses a duration string and returns the time.Duration. A duration is a sequence
+// of decimal numbers, each with an optional fraction and a unit, such as "3h", "1h30m", "1.5h",
+// "2d12h" or "500ms". Valid units are "ns", "us" (or "µs"), "ms", "s", "m", "h", "d" and "w".
+// Malformed durations are reported as a *ParseError.
 func ParseDuration(duration string) (*time.Duration, error) {
-	matches := durationRegex.FindStringSubmatch(duration)
-	if len(matches) != 3 {
-		return nil, fmt.Errorf("invalid since format '%s', expected format <duration><unit> (e.g. 3h)", duration)
+	s := duration
+	fail := func(reason string) (*time.Duration, error) {
+		return nil, &ParseError{Kind: "duration", Input: duration, Offset: len(duration) - len(s), Reason: reason}
 	}
-	amount, err := strconv.ParseInt(matches[1], 10, 64)
-	if err != nil {
-		log.Fatal(err)
+	if s == "" {
+		return fail("expected format <duration><unit> (e.g. 3h or 1h30m)")
 	}
-	var unit time.Duration
-	switch matches[2] {
-	case "s":
-		unit = time.Second
-	case "m":
-		unit = time.Minute
-	case "h":
-		unit = time.Hour
-	case "d":
-		unit = time.Hour * 24
+	var total uint64
+	for s != "" {
+		var v, f uint64
+		scale := 1.0
+
+		if !isDigit(s[0]) && s[0] != '.' {
+			return fail("expected a number")
+		}
+		start := s
+		pl := len(s)
+		var ok bool
+		v, s, ok = leadingInt(s)
+		if !ok {
+			s = start
+			return fail("duration out of range")
+		}
+		pre := pl != len(s)
+
+		post := false
+		if s != "" && s[0] == '.' {
+			s = s[1:]
+			pl := len(s)
+			f, scale, s = leadingFraction(s)
+			post = pl != len(s)
+		}
+		if !pre && !post {
+			s = start
+			return fail("expected a number")
+		}
+
+		i := 0
+		for i < len(s) && s[i] != '.' && !isDigit(s[i]) {
+			i++
+		}
+		if i == 0 {
+			return fail("missing unit")
+		}
+		unit, ok := unitMap[s[:i]]
+		if !ok {
+			return fail(fmt.Sprintf("unknown unit '%s'", s[:i]))
+		}
+
+		if v > 1<<63/unit {
+			s = start
+			return fail("duration out of range")
+		}
+		v *= unit
+		if f > 0 {
+			v += uint64(float64(f) * (float64(unit) / scale))
+			if v > 1<<63-1 {
+				s = start
+				return fail("duration out of range")
+			}
+		}
+		total += v
+		if total > 1<<63-1 {
+			s = start
+			return fail("duration out of range")
+		}
+		s = s[i:]
 	}
-	dur := unit * time.Duration(amount)
+	dur := time.Duration(total)
 	return &dur, nil
 }
 
-// ParseSince parses a duration string and returns a time.Time in history relative to current time
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// leadingInt consumes the leading [0-9]* from s, reporting false if it overflows.
+func leadingInt(s string) (x uint64, rem string, ok bool) {
+	i := 0
+	for ; i < len(s) && isDigit(s[i]); i++ {
+		if x > 1<<63/10 {
+			return 0, "", false
+		}
+		x = x*10 + uint64(s[i]-'0')
+		if x > 1<<63 {
+			return 0, "", false
+		}
+	}
+	return x, s[i:], true
+}
+
+// leadingFraction consumes the leading [0-9]* from s. Digits beyond the precision of x are
+// dropped rather than overflowing.
+func leadingFraction(s string) (x uint64, scale float64, rem string) {
+	i := 0
+	scale = 1
+	overflow := false
+	for ; i < len(s) && isDigit(s[i]); i++ {
+		if overflow {
+			continue
+		}
+		if x > (1<<63-1)/10 {
+			overflow = true
+			continue
+		}
+		y := x*10 + uint64(s[i]-'0')
+		if y > 1<<63 {
+			overflow = true
+			continue
+		}
+		x = y
+		scale *= 10
+	}
+	return x, scale, s[i:]
+}
+
+// ParseSince parses a duration string and returns a time.Time in history relative to current time.
+// Malformed durations are reported as a *ParseError.
 func ParseSince(duration string) (*time.Time, error) {
+	return ParseSinceWithClock(RealClock{}, duration)
+}
+
+// ParseSinceWithClock is like ParseSince but takes the current time from the given clock.
+func ParseSinceWithClock(clock Clock, duration string) (*time.Time, error) {
 	dur, err := ParseDuration(duration)
 	if err != nil {
-		return nil, err
+		return nil, withKind(err, "since expression")
 	}
-	since := time.Now().UTC().Add(-*dur)
+	since := clock.Now().UTC().Add(-*dur)
 	return &since, nil
 }
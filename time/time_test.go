@@ -1,6 +1,7 @@
 package time
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -22,6 +23,28 @@ func TestParseDuration(t *testing.T) {
 		{"1h", time.Hour},
 		{"1d", 24 * time.Hour},
 		{"2d", 48 * time.Hour},
+		{"0s", 0},
+		{"1w", 7 * 24 * time.Hour},
+		{"500ms", 500 * time.Millisecond},
+		{"250us", 250 * time.Microsecond},
+		{"250µs", 250 * time.Microsecond},
+		{"250μs", 250 * time.Microsecond},
+		{"42ns", 42 * time.Nanosecond},
+		{"1h30m", 90 * time.Minute},
+		{"2d12h", 60 * time.Hour},
+		{"1w2d3h4m5s6ms", 9*24*time.Hour + 3*time.Hour + 4*time.Minute + 5*time.Second + 6*time.Millisecond},
+		{"30m1h", 90 * time.Minute},
+		{"1.5h", 90 * time.Minute},
+		{".5m", 30 * time.Second},
+		{"1.s", time.Second},
+		{"0.5d", 12 * time.Hour},
+		{"1.25s500ms", 1750 * time.Millisecond},
+		{"0.000000001s", time.Nanosecond},
+		{"0.1234567891234567890123456789s", 123456789 * time.Nanosecond},
+		{"9223372036854775807ns", 1<<63 - 1},
+		{"9223372036.854775807s", 1<<63 - 1},
+		{"2562047h47m16.854775807s", 1<<63 - 1},
+		{"15250w", 15250 * 7 * 24 * time.Hour},
 	}
 	for _, data := range testdata {
 		dur, err := ParseDuration(data.duration)
@@ -32,10 +55,82 @@ func TestParseDuration(t *testing.T) {
 	assert.Error(t, err)
 }
 
+// TestParseDurationInvalid tests rejection of malformed and out of range durations
+func TestParseDurationInvalid(t *testing.T) {
+	testdata := []string{
+		"",
+		"1",
+		"h",
+		"1.5",
+		".",
+		".h",
+		"-1h",
+		"+1h",
+		"1h30",
+		"1 h",
+		"1h ",
+		" 1h",
+		"1hh",
+		"1H",
+		"1..5h",
+		"1.5.5h",
+		"1y",
+		"9223372036854775808ns",
+		"9223372036.854775808s",
+		"2562047h47m16.854775808s",
+		"106752d",
+		"15251w",
+		"100000000000000000000s",
+		"9223372036854775807ns1ns",
+	}
+	for _, duration := range testdata {
+		_, err := ParseDuration(duration)
+		assert.Error(t, err, duration)
+	}
+}
+
+// TestParseDurationError tests the position and reason of parse errors
+func TestParseDurationError(t *testing.T) {
+	type testData struct {
+		duration string
+		offset   int
+		reason   string
+	}
+	testdata := []testData{
+		{"", 0, "expected format <duration><unit> (e.g. 3h or 1h30m)"},
+		{"h", 0, "expected a number"},
+		{"1h.m", 2, "expected a number"},
+		{"-1h", 0, "expected a number"},
+		{"1h30", 4, "missing unit"},
+		{"1z", 1, "unknown unit 'z'"},
+		{"1h30x", 4, "unknown unit 'x'"},
+		{"100000000000000000000s", 0, "duration out of range"},
+		{"1h9223372036854775807ns", 2, "duration out of range"},
+		{"1h106752d", 2, "duration out of range"},
+	}
+	for _, data := range testdata {
+		_, err := ParseDuration(data.duration)
+		var parseErr *ParseError
+		require.ErrorAs(t, err, &parseErr, data.duration)
+		assert.Equal(t, &ParseError{Kind: "duration", Input: data.duration, Offset: data.offset, Reason: data.reason}, parseErr)
+	}
+	_, err := ParseDuration("1z")
+	assert.EqualError(t, err, "invalid duration '1z' at offset 1: unknown unit 'z'")
+
+	_, err = ParseSince("1z")
+	var parseErr *ParseError
+	require.True(t, errors.As(err, &parseErr))
+	assert.EqualError(t, err, "invalid since expression '1z' at offset 1: unknown unit 'z'")
+}
+
 // TestParseSince tests parsing of since strings
 func TestParseSince(t *testing.T) {
-	oneDayAgo, err := ParseSince("1d")
+	now := time.Date(2026, 10, 2, 12, 30, 15, 0, time.FixedZone("CEST", 2*60*60))
+	oneDayAgo, err := ParseSinceWithClock(NewFakeClock(now), "1d")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 1, 10, 30, 15, 0, time.UTC), *oneDayAgo)
+
+	oneDayAgo, err = ParseSince("1d")
 	require.NoError(t, err)
-	yesterday := time.Now().UTC().Add(-24 * time.Hour)
-	assert.Equal(t, yesterday.Minute(), oneDayAgo.Minute())
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), *oneDayAgo, time.Minute)
 }